@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/controller"
+)
+
+// runInventory prints the Certificates matching the filters joined with their copies in AWS ACM
+func runInventory(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("inventory", &opts)
+	output := fs.String("output", "text", "The output format, text or json.")
+	_ = fs.Parse(args)
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	entries, err := controller.BuildInventory(context.Background(), c, awsACMService, controller.FiltersFromEnv())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if *output == "json" {
+		if entries == nil {
+			entries = []controller.InventoryEntry{}
+		}
+		if err := printJSON(entries); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OWNER\tDOMAIN\tSTATUS\tARN\tNOT AFTER\tIN USE BY")
+	for _, entry := range entries {
+		notAfter := ""
+		if entry.NotAfter != nil {
+			notAfter = entry.NotAfter.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Owner, entry.Domain, entry.Status, entry.ARN, notAfter,
+			strings.Join(entry.InUseBy, ","))
+	}
+	_ = w.Flush()
+	return exitOK
+}
+
+// runResync reconciles a single Certificate right away, with the reconciler of the manager,
+// re-importing it even when its ACM copies match
+func runResync(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("resync", &opts)
+	timeout := fs.Duration("timeout", 5*time.Minute, "How long to retry before giving up.")
+	dropRootCertificates := fs.Bool("drop-root-certificates", false,
+		"If set, the self-signed root certificates are removed from the certificate chains imported into AWS ACM.")
+	deletionGracePeriod := bindDeletionGracePeriod(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: resync [flags] <namespace>/<name>")
+		return exitError
+	}
+	key, err := parseNamespacedName(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	awsACMService.DropRootCertificates = *dropRootCertificates
+	awsACMService.DeletionGracePeriod = *deletionGracePeriod
+
+	reconciler := &controller.CertManagerCertificateReconciler{
+		Client:        c,
+		Log:           ctrl.Log.WithName("controllers").WithName("CertificateSync"),
+		Scheme:        scheme,
+		AWSACMService: awsACMService,
+		ForceImport:   true,
+	}
+	result := reconciler.SyncOnce(ctrl.SetupSignalHandler(), key, *timeout)
+	counts := printSyncResults([]controller.SyncResult{result}, "text")
+	if counts[controller.SyncStatusSynced] == 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// runGC deletes from AWS ACM the certificates whose owner object no longer exists
+func runGC(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("gc", &opts)
+	dryRun := fs.Bool("dry-run", false, "Only list the ACM certificates that would be deleted.")
+	deletionGracePeriod := bindDeletionGracePeriod(fs)
+	_ = fs.Parse(args)
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	awsACMService.DryRun = *dryRun
+	awsACMService.DeletionGracePeriod = *deletionGracePeriod
+
+	results, err := controller.CollectGarbage(context.Background(), c, awsACMService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	status := exitOK
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	marked := "marked pending deletion"
+	if *dryRun {
+		marked = "would mark pending deletion"
+	}
+	for _, result := range results {
+		if result.PendingDeletion {
+			fmt.Printf("%s %s (%s, owner %s)\n", marked, result.ARN, result.Domain, result.Owner)
+		} else if result.Deleted {
+			fmt.Printf("%s %s (%s, owner %s)\n", verb, result.ARN, result.Domain, result.Owner)
+		} else {
+			fmt.Printf("kept %s (%s, owner %s): %s\n", result.ARN, result.Domain, result.Owner, result.Reason)
+			status = exitError
+		}
+	}
+	if len(results) == 0 {
+		fmt.Println("No orphaned ACM certificate.")
+	}
+	return status
+}
+
+// runAdopt makes a Certificate the owner of an existing ACM certificate
+func runAdopt(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("adopt", &opts)
+	dryRun := fs.Bool("dry-run", false, "Only check the adoption, without tagging the ACM certificate.")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: adopt [flags] <namespace>/<name> <certificate-arn>")
+		return exitError
+	}
+	key, err := parseNamespacedName(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	awsACMService.DryRun = *dryRun
+
+	if err := controller.AdoptCertificate(context.Background(), c, awsACMService, key, fs.Arg(1)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("Certificate %s adopted %s\n", key, fs.Arg(1))
+	return exitOK
+}
+
+// runUninstall removes the finalizer from every synced Certificate and Secret, so that the controller can be removed
+// without blocking their deletion, after releasing their ACM copies according to the chosen deletion policy
+func runUninstall(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("uninstall", &opts)
+	dryRun := fs.Bool("dry-run", false, "Only list the objects that would be released, without changing anything.")
+	policyFlag := fs.String("deletion-policy", "none",
+		"What to do with the ACM certificates first: Delete, Retain (untag them) or none (leave them untouched).")
+	deployment := fs.String("scale-down", "",
+		"The <namespace>/<name> of the controller Deployment, scaled down first so that it does not add the finalizers back.")
+	timeout := fs.Duration("timeout", 2*time.Minute, "How long to wait for the controller Deployment to be scaled down.")
+	output := fs.String("output", "text", "The output format, text or json.")
+	_ = fs.Parse(args)
+
+	policy, err := controller.ParseDeletionPolicy(*policyFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	awsACMService.DryRun = *dryRun
+
+	ctx := context.Background()
+	if *deployment != "" && !*dryRun {
+		key, err := parseNamespacedName(*deployment)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		if err := scaleDownDeployment(ctx, c, key, *timeout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	results, err := controller.Uninstall(ctx, c, awsACMService, policy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	status := exitOK
+	for _, result := range results {
+		if !result.Released {
+			status = exitError
+		}
+	}
+	if *output == "json" {
+		if results == nil {
+			results = []controller.UninstallResult{}
+		}
+		if err := printJSON(results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return status
+	}
+
+	verb := "released"
+	if *dryRun {
+		verb = "would release"
+	}
+	for _, result := range results {
+		if result.Released {
+			fmt.Printf("%s %s", verb, result.Object)
+		} else {
+			fmt.Printf("failed to release %s", result.Object)
+		}
+		if policy != "" && len(result.Domains) > 0 {
+			fmt.Printf(" (%s ACM certificates of %s)", strings.ToLower(string(policy)), strings.Join(result.Domains, ", "))
+		}
+		if result.Reason != "" {
+			fmt.Printf(": %s", result.Reason)
+		}
+		fmt.Println()
+	}
+	if len(results) == 0 {
+		fmt.Println("No object carries the finalizer.")
+	}
+	return status
+}
+
+// Scale the controller Deployment down to zero replicas and wait for its pods to be gone
+func scaleDownDeployment(ctx context.Context, c client.Client, key types.NamespacedName, timeout time.Duration) error {
+	var deployment appsv1.Deployment
+	if err := c.Get(ctx, key, &deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get Deployment %s: %w", key, err)
+	}
+	patch := client.MergeFrom(deployment.DeepCopy())
+	replicas := int32(0)
+	deployment.Spec.Replicas = &replicas
+	if err := c.Patch(ctx, &deployment, patch); err != nil {
+		return fmt.Errorf("failed to scale down Deployment %s: %w", key, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for deployment.Status.Replicas > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("deployment %s still has %d replicas after %s", key, deployment.Status.Replicas, timeout)
+		}
+		time.Sleep(2 * time.Second)
+		if err := c.Get(ctx, key, &deployment); err != nil {
+			return fmt.Errorf("failed to get Deployment %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	services "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Exit codes of the subcommands
+const (
+	exitOK    = 0
+	exitError = 1
+	// Returned when the cluster and AWS ACM are not in sync
+	exitDrift = 2
+)
+
+// AWS options of the subcommands
+type awsOptions struct {
+	region string
+	limits services.APILimits
+}
+
+// Create the flag set of a subcommand, with the kubeconfig, AWS and logging flags
+func newCommandFlagSet(name string, opts *zap.Options) (*flag.FlagSet, *awsOptions) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	config.RegisterFlags(fs)
+	awsOpts := &awsOptions{limits: services.DefaultAPILimits}
+	fs.StringVar(&awsOpts.region, "region", os.Getenv("AWS_REGION"), "The AWS region of ACM. Defaults to $AWS_REGION.")
+	awsOpts.limits.BindFlags(fs)
+	opts.BindFlags(fs)
+	return fs, awsOpts
+}
+
+// Register the --deletion-grace-period flag of the subcommands releasing ACM certificates
+func bindDeletionGracePeriod(fs *flag.FlagSet) *time.Duration {
+	return fs.Duration("deletion-grace-period", 0,
+		"Delay before the AWS ACM certificates no longer synced are deleted, marked pending deletion in the meantime. "+
+			"Set it to the value of the manager, which deletes them once it elapsed. Use 0 to delete them right away.")
+}
+
+// Create the Kubernetes client and the AWS ACM service used by a subcommand
+func newCommandClients(awsOpts *awsOptions, opts *zap.Options) (client.Client, *services.AWSACMService, error) {
+	// Logs go to stderr, stdout is kept for the command output
+	opts.DestWriter = os.Stderr
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(opts)))
+
+	if err := certmanagerv1.AddToScheme(scheme); err != nil {
+		return nil, nil, fmt.Errorf("unable to add cert-manager v1 to scheme: %w", err)
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to load kubeconfig: %w", err)
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create Kubernetes client: %w", err)
+	}
+
+	awsACMService, err := services.NewAWSACMService(awsOpts.region, awsOpts.limits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create AWS ACM service: %w", err)
+	}
+	return c, awsACMService, nil
+}
+
+// Parse a <namespace>/<name> command argument
+func parseNamespacedName(value string) (types.NamespacedName, error) {
+	namespace, name, found := strings.Cut(value, "/")
+	if !found || namespace == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid Certificate %q, expected <namespace>/<name>", value)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: name}, nil
+}
+
+// Print a value as indented JSON on stdout
+func printJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
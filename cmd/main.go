@@ -20,21 +20,27 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	"github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/controller"
 	services "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
@@ -48,16 +54,42 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
 
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	// Subcommands, the manager is run when none is given
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "plan":
+			os.Exit(runPlan(os.Args[2:]))
+		case "sync":
+			os.Exit(runSync(os.Args[2:]))
+		case "inventory":
+			os.Exit(runInventory(os.Args[2:]))
+		case "resync":
+			os.Exit(runResync(os.Args[2:]))
+		case "gc":
+			os.Exit(runGC(os.Args[2:]))
+		case "adopt":
+			os.Exit(runAdopt(os.Args[2:]))
+		case "uninstall":
+			os.Exit(runUninstall(os.Args[2:]))
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var dryRun bool
+	var driftCheckInterval time.Duration
+	var dropRootCertificates bool
+	var deletionGracePeriod time.Duration
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -69,6 +101,18 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"If set, AWS ACM is only read: the imports, updates and deletions are logged, reported as events and "+
+			"counted in metrics instead of being performed.")
+	flag.DurationVar(&driftCheckInterval, "drift-check-interval", time.Hour,
+		"Interval of the checks that the AWS ACM copies still match their Secret. Use 0 to disable the checks.")
+	flag.BoolVar(&dropRootCertificates, "drop-root-certificates", false,
+		"If set, the self-signed root certificates are removed from the certificate chains imported into AWS ACM.")
+	flag.DurationVar(&deletionGracePeriod, "deletion-grace-period", 0,
+		"Delay before the AWS ACM certificates no longer synced are deleted, marked pending deletion in the meantime "+
+			"so that they are taken back if synced again. Use 0 to delete them right away.")
+	apiLimits := services.DefaultAPILimits
+	apiLimits.BindFlags(flag.CommandLine)
 	opts := zap.Options{
 		Development: true,
 	}
@@ -151,21 +195,93 @@ func main() {
 	}
 
 	// Instantiate the AWS ACM service
-	awsACMService, err := services.NewAWSACMService(os.Getenv("AWS_REGION"))
+	awsACMService, err := services.NewAWSACMService(os.Getenv("AWS_REGION"), apiLimits)
 	if err != nil {
 		setupLog.Error(err, "unable to create AWS ACM service")
 		os.Exit(1)
 	}
+	awsACMService.DryRun = dryRun
+	awsACMService.DropRootCertificates = dropRootCertificates
+	awsACMService.DeletionGracePeriod = deletionGracePeriod
+	if dryRun {
+		setupLog.Info("dry-run mode enabled, AWS ACM will not be modified")
+	}
+	// Warn once, on the controller Pod, when the calls to AWS ACM are paused by the circuit breaker
+	recorder := mgr.GetEventRecorderFor("acm-cmcertificate-sync")
+	if podName, podNamespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE"); podName != "" && podNamespace != "" {
+		pod := &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: podName, Namespace: podNamespace}
+		awsACMService.OnCircuitBreakerOpen = func(err error) {
+			recorder.Eventf(pod, corev1.EventTypeWarning, "ACMUnavailable",
+				"Calls to AWS ACM are paused for every certificate until it answers again: %v", err)
+		}
+	}
+	if err := mgr.Add(manager.RunnableFunc(awsACMService.ProbeCircuitBreaker)); err != nil {
+		setupLog.Error(err, "unable to set up AWS ACM circuit breaker probes")
+		os.Exit(1)
+	}
+	// Without a grace period, a single sweep deletes the certificates marked while there was one
+	if err := mgr.Add(&controller.PendingDeletionSweeper{
+		Log:                 ctrl.Log.WithName("PendingDeletionSweeper"),
+		AWSACMService:       awsACMService,
+		DeletionGracePeriod: deletionGracePeriod,
+		Once:                deletionGracePeriod == 0,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up the sweeper of the AWS ACM certificates pending deletion")
+		os.Exit(1)
+	}
 
 	if err = (&controller.CertManagerCertificateReconciler{
-		Client:        mgr.GetClient(),
-		Log:           ctrl.Log.WithName("controllers").WithName("CertificateSync"),
-		Scheme:        mgr.GetScheme(),
-		AWSACMService: awsACMService,
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("CertificateSync"),
+		Scheme:             mgr.GetScheme(),
+		AWSACMService:      awsACMService,
+		Recorder:           recorder,
+		DriftCheckInterval: driftCheckInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateSync")
 		os.Exit(1)
 	}
+	if err = (&controller.TLSSecretReconciler{
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("TLSSecretSync"),
+		Scheme:             mgr.GetScheme(),
+		AWSACMService:      awsACMService,
+		Recorder:           recorder,
+		DriftCheckInterval: driftCheckInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TLSSecretSync")
+		os.Exit(1)
+	}
+	if err = (&controller.IngressReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Ingress"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Ingress")
+		os.Exit(1)
+	}
+	if err = (&controller.ServiceReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("Service"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
+		os.Exit(1)
+	}
+
+	// The Gateway API integration is only enabled when its CRDs are installed
+	if gatewayAPIInstalled(mgr) {
+		if err = (&controller.GatewayReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("Gateway"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Gateway")
+			os.Exit(1)
+		}
+	} else {
+		setupLog.Info("Gateway API CRDs not found, Gateway integration disabled")
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -176,6 +292,10 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if err := mgr.AddReadyzCheck("acm", awsACMService.CheckCircuitBreaker); err != nil {
+		setupLog.Error(err, "unable to set up AWS ACM ready check")
+		os.Exit(1)
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -183,3 +303,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// Check if the Gateway API CRDs the Gateway integration watches, Gateways and ReferenceGrants, are installed
+func gatewayAPIInstalled(mgr ctrl.Manager) bool {
+	if _, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{Group: gatewayv1.GroupName, Kind: "Gateway"},
+		gatewayv1.GroupVersion.Version); err != nil {
+		return false
+	}
+	_, err := mgr.GetRESTMapper().RESTMapping(schema.GroupKind{Group: gatewayv1beta1.GroupName, Kind: "ReferenceGrant"},
+		gatewayv1beta1.GroupVersion.Version)
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/controller"
+)
+
+// Symbols of the actions in the text output, Terraform style
+var planActionSymbols = map[string]string{
+	controller.PlanActionCreate: "+",
+	controller.PlanActionUpdate: "~",
+	controller.PlanActionDelete: "-",
+	controller.PlanActionRetain: "=",
+	controller.PlanActionAdopt:  ">",
+}
+
+// runPlan diffs the Certificates of the cluster against AWS ACM and prints the actions the controller would perform.
+// It exits with exitDrift when there is at least one action, so that it can gate a CI pipeline.
+func runPlan(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("plan", &opts)
+	output := fs.String("output", "text", "The output format, text or json.")
+	watchedNamespaces := fs.String("watched-namespaces", os.Getenv("WATCHED_NAMESPACES"),
+		"Comma separated namespaces to plan for, empty or all-namespaces for all. Defaults to $WATCHED_NAMESPACES.")
+	domainPatterns := fs.String("domain-patterns", os.Getenv("DOMAIN_PATTERNS"),
+		"Comma separated domain patterns to plan for. Defaults to $DOMAIN_PATTERNS.")
+	_ = fs.Parse(args)
+
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported output format %q\n", *output)
+		return exitError
+	}
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	// The plan never modifies AWS ACM
+	awsACMService.DryRun = true
+
+	filters := controller.Filters{
+		WatchedNamespaces: *watchedNamespaces,
+		DomainPatterns:    strings.Split(*domainPatterns, ","),
+	}
+	actions, err := controller.BuildPlan(context.Background(), c, awsACMService, filters)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if *output == "json" {
+		if actions == nil {
+			actions = []controller.PlanAction{}
+		}
+		if err := printJSON(actions); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	} else {
+		printPlan(actions)
+	}
+
+	if len(actions) > 0 {
+		return exitDrift
+	}
+	return exitOK
+}
+
+// Print the actions, and a summary, as text
+func printPlan(actions []controller.PlanAction) {
+	if len(actions) == 0 {
+		fmt.Println("No changes. AWS ACM is in sync with the cluster.")
+		return
+	}
+
+	counts := map[string]int{}
+	for _, action := range actions {
+		counts[action.Action]++
+		fmt.Printf("  %s %-6s %s %s", planActionSymbols[action.Action], action.Action, action.Owner, action.Domain)
+		if action.ARN != "" {
+			fmt.Printf(" (%s)", action.ARN)
+		}
+		fmt.Printf("\n      # %s\n", action.Reason)
+	}
+	fmt.Printf("\nPlan: %d to create, %d to update, %d to delete, %d to retain, %d to adopt.\n",
+		counts[controller.PlanActionCreate], counts[controller.PlanActionUpdate],
+		counts[controller.PlanActionDelete], counts[controller.PlanActionRetain], counts[controller.PlanActionAdopt])
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/controller"
+)
+
+// runSync reconciles every matching Certificate, or a single one, once with the reconciler of the manager,
+// prints a summary and exits with exitError if any of them could not be synced or does not match the filters,
+// exitDrift if any is not ready
+func runSync(args []string) int {
+	opts := zap.Options{}
+	fs, awsOpts := newCommandFlagSet("sync", &opts)
+	once := fs.Bool("once", false, "Reconcile once and exit. Required, the continuous mode is the manager.")
+	certificateName := fs.String("certificate", "", "Only sync this Certificate, as <namespace>/<name>.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "How long to retry each Certificate before giving up.")
+	concurrency := fs.Int("concurrency", 10, "How many Certificates to sync at the same time.")
+	dryRun := fs.Bool("dry-run", false, "Only read AWS ACM, log the mutations instead of performing them.")
+	dropRootCertificates := fs.Bool("drop-root-certificates", false,
+		"If set, the self-signed root certificates are removed from the certificate chains imported into AWS ACM.")
+	deletionGracePeriod := bindDeletionGracePeriod(fs)
+	output := fs.String("output", "text", "The summary output format, text or json.")
+	_ = fs.Parse(args)
+
+	if !*once {
+		fmt.Fprintln(os.Stderr, "sync requires --once, run the binary without subcommand to start the manager")
+		return exitError
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported output format %q\n", *output)
+		return exitError
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "--concurrency must be at least 1")
+		return exitError
+	}
+
+	c, awsACMService, err := newCommandClients(awsOpts, &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	awsACMService.DryRun = *dryRun
+	awsACMService.DropRootCertificates = *dropRootCertificates
+	awsACMService.DeletionGracePeriod = *deletionGracePeriod
+
+	ctx := ctrl.SetupSignalHandler()
+	keys, err := certificatesToSync(ctx, c, *certificateName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	reconciler := &controller.CertManagerCertificateReconciler{
+		Client:        c,
+		Log:           ctrl.Log.WithName("controllers").WithName("CertificateSync"),
+		Scheme:        scheme,
+		AWSACMService: awsACMService,
+	}
+	// The Certificates are synced concurrently, so that the ones not issued yet do not wait for each other
+	results := make([]controller.SyncResult, len(keys))
+	slots := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, key types.NamespacedName) {
+			defer wg.Done()
+			results[i] = reconciler.SyncOnce(ctx, key, *timeout)
+			<-slots
+		}(i, key)
+	}
+	wg.Wait()
+
+	counts := printSyncResults(results, *output)
+	switch {
+	case counts[controller.SyncStatusFailed] > 0 || counts[controller.SyncStatusSkipped] > 0:
+		return exitError
+	case counts[controller.SyncStatusNotReady] > 0:
+		return exitDrift
+	}
+	return exitOK
+}
+
+// List the Certificates to sync: the named one, or all those matching the filters
+func certificatesToSync(ctx context.Context, c client.Client, name string) ([]types.NamespacedName, error) {
+	if name != "" {
+		key, err := parseNamespacedName(name)
+		if err != nil {
+			return nil, err
+		}
+		return []types.NamespacedName{key}, nil
+	}
+
+	certificates, err := controller.ListMatchingCertificates(ctx, c, controller.FiltersFromEnv())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Certificates: %w", err)
+	}
+	keys := make([]types.NamespacedName, 0, len(certificates))
+	for _, certificate := range certificates {
+		keys = append(keys, types.NamespacedName{Namespace: certificate.Namespace, Name: certificate.Name})
+	}
+	return keys, nil
+}
+
+// Print the results of the sync and return the number of Certificates by status
+func printSyncResults(results []controller.SyncResult, output string) map[string]int {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	if output == "json" {
+		_ = printJSON(results)
+	} else {
+		for _, result := range results {
+			fmt.Printf("%-10s %s (%d attempts)", result.Status, result.Certificate, result.Attempts)
+			if result.Error != "" {
+				fmt.Printf(": %s", result.Error)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("\nSync: %d synced, %d not ready, %d skipped, %d failed.\n", counts[controller.SyncStatusSynced],
+			counts[controller.SyncStatusNotReady], counts[controller.SyncStatusSkipped], counts[controller.SyncStatusFailed])
+	}
+	return counts
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+const certificateFinalizer = "acm-cmcertificate-sync/finalizer"
+
+// Annotation forcing, on a synced Certificate or Secret, the next import of a certificate outside of its validity
+// period or older than its AWS ACM copy. It is removed once the certificate is synced.
+const forceImportAnnotation = "acm-cmcertificate-sync/force-import"
+
+// Import the certificate and its private key into AWS ACM, once per identity, updating the ACM copies recorded on the
+// object, and return the ARNs of the ACM copies by identity
+func importToACM(svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder, obj client.Object,
+	dnsNames []string, certData, keyData []byte, chain aws_acm_svc.ChainOptions) (map[string]string, error) {
+	// Outdated certificates are only imported when explicitly forced
+	force := obj.GetAnnotations()[forceImportAnnotation] == "true"
+	imported := getImportedCertificates(obj)
+	copies := map[string]string{}
+	for _, dnsName := range dnsNames {
+		arn, err := svc.ImportOrUpdateCertificate(dnsName, imported[dnsName], ownerID(obj), string(certData),
+			string(keyData), chain, force)
+		if err != nil {
+			if errors.Is(err, aws_acm_svc.ErrDowngrade) || errors.Is(err, aws_acm_svc.ErrInvalidPeriod) {
+				recordEvent(recorder, obj, corev1.EventTypeWarning, "ImportRefused",
+					"Refused to import the certificate for domain %s into AWS ACM, annotate with %s: \"true\" to force it: %v",
+					dnsName, forceImportAnnotation, err)
+			}
+			return nil, err
+		}
+		if svc.DryRun {
+			if arn == "" {
+				recordEvent(recorder, obj, corev1.EventTypeNormal, "DryRunImport",
+					"Dry run: would import a new certificate in AWS ACM for domain %s", dnsName)
+				continue
+			}
+			recordEvent(recorder, obj, corev1.EventTypeNormal, "DryRunUpdate",
+				"Dry run: would update AWS ACM certificate %s for domain %s", arn, dnsName)
+		}
+		copies[dnsName] = arn
+	}
+	return copies, nil
+}
+
+// Import the certificate into AWS ACM unless its recorded ACM copies already match it, and return their ARNs by
+// identity. An ACM copy that no longer matches while the Secret did not change since the last import has drifted:
+// it is reported and overwritten.
+func syncToACM(svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder, obj client.Object,
+	dnsNames []string, certData, keyData []byte, chain aws_acm_svc.ChainOptions, force bool) (map[string]string, error) {
+	imported := getImportedCertificates(obj)
+	fingerprint, err := aws_acm_svc.Fingerprint(string(certData), string(keyData))
+	if err != nil {
+		return nil, err
+	}
+
+	copies := map[string]string{}
+	for _, dnsName := range dnsNames {
+		if arn, found := imported[dnsName]; found {
+			copies[dnsName] = arn
+		}
+	}
+	if !force && len(copies) == len(dnsNames) && obj.GetAnnotations()[importedFingerprintAnnotation] == fingerprint {
+		var drifted []string
+		for _, arn := range copiesARNs(dnsNames, copies) {
+			matches, err := svc.CertificateMatches(arn, string(certData), string(keyData))
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				drifted = append(drifted, arn)
+			}
+		}
+		if len(drifted) == 0 {
+			return copies, nil
+		}
+		driftDetectedTotal.Inc()
+		recordEvent(recorder, obj, corev1.EventTypeWarning, "DriftDetected",
+			"AWS ACM certificates %v no longer match the Secret certificate, re-importing", drifted)
+	}
+
+	return importToACM(svc, recorder, obj, dnsNames, certData, keyData, chain)
+}
+
+// Record on the synced object the ARNs of its ACM copies, by identity and for the load balancer integrations, and the
+// fingerprint of the imported certificate. Nothing is recorded but the reset of the failures in dry-run mode: the ARNs
+// are the ones of the ACM certificates which would be overwritten, and must not reach the load balancer integrations.
+func recordSync(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, obj client.Object,
+	dnsNames []string, copies map[string]string, certData, keyData []byte) error {
+	values := map[string]string{
+		// Reset the backoff of the failed syncs
+		failureCountAnnotation: "",
+		nextRetryAnnotation:    "",
+		lastErrorAnnotation:    "",
+		// End the wait for a rotation
+		rotationWaitSinceAnnotation: "",
+	}
+	if !svc.DryRun {
+		fingerprint, err := aws_acm_svc.Fingerprint(string(certData), string(keyData))
+		if err != nil {
+			return err
+		}
+		values[certificateARNsAnnotation] = strings.Join(copiesARNs(dnsNames, copies), ",")
+		values[importedCertificatesAnnotation] = formatImportedCertificates(copies)
+		values[importedFingerprintAnnotation] = fingerprint
+		// A forced import only applies once
+		values[forceImportAnnotation] = ""
+	}
+	return setAnnotations(ctx, c, obj, values)
+}
+
+// Release the ACM copies of a synced object being deleted or no longer synced, the ones of its current DNS names
+// and the ones recorded as imported, according to a deletion policy
+func deleteFromACM(svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder, obj client.Object, dnsNames []string,
+	policy DeletionPolicy) error {
+	copies, err := releasedCopies(svc, obj, dnsNames)
+	if err != nil {
+		return err
+	}
+	for _, domain := range releasedDomains(obj, dnsNames) {
+		arn, found := copies[domain]
+		if !found {
+			continue
+		}
+		if err := releaseACMCertificate(svc, recorder, obj, domain, arn, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release a synced object which is no longer synced: its ACM copies according to a deletion policy,
+// the annotations recording them, and its finalizer
+func releaseFromACM(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder,
+	obj client.Object, dnsNames []string, policy DeletionPolicy) error {
+	if err := deleteFromACM(svc, recorder, obj, dnsNames, policy); err != nil {
+		return err
+	}
+	values := map[string]string{}
+	for _, annotation := range ownAnnotations {
+		values[annotation] = ""
+	}
+	if err := setAnnotations(ctx, c, obj, values); err != nil {
+		return err
+	}
+	return removeFinalizer(ctx, c, obj)
+}
+
+// Identify the synced object in the owner tag of its ACM copies, as <Kind>/<namespace>/<name>
+func ownerID(obj client.Object) string {
+	kind := "Certificate"
+	if _, ok := obj.(*corev1.Secret); ok {
+		kind = "Secret"
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, obj.GetNamespace(), obj.GetName())
+}
+
+// Emit an event on the object, when the reconciler was given an event recorder
+func recordEvent(recorder record.EventRecorder, obj client.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// Parse the leaf certificate, the one matching the private key wherever it is in the certificate data
+func parseLeaf(certData, keyData []byte) (*x509.Certificate, error) {
+	return aws_acm_svc.LeafCertificate(string(certData), string(keyData))
+}
+
+// Add the finalizer to the object if it doesn't exist
+func addFinalizer(ctx context.Context, c client.Client, obj client.Object) error {
+	if !containsString(obj.GetFinalizers(), certificateFinalizer) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), certificateFinalizer))
+		if err := c.Update(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the finalizer from the object
+func removeFinalizer(ctx context.Context, c client.Client, obj client.Object) error {
+	if containsString(obj.GetFinalizers(), certificateFinalizer) {
+		obj.SetFinalizers(removeString(obj.GetFinalizers(), certificateFinalizer))
+		if err := c.Update(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Helper functions for handling finalizers
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(slice []string, s string) []string {
+	var result []string
+	for _, item := range slice {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
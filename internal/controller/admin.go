@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Statuses of the inventory entries
+const (
+	InventoryStatusSynced   = "synced"
+	InventoryStatusMissing  = "missing"
+	InventoryStatusOrphaned = "orphaned"
+	InventoryStatusUnowned  = "unowned"
+	// Marked pending deletion, deleted once the deletion grace period elapsed
+	InventoryStatusPendingDeletion = "pending-deletion"
+)
+
+// InventoryEntry joins a domain of a synced object and its copy in AWS ACM
+type InventoryEntry struct {
+	Owner    string     `json:"owner,omitempty"`
+	Domain   string     `json:"domain"`
+	ARN      string     `json:"arn,omitempty"`
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+	InUseBy  []string   `json:"inUseBy,omitempty"`
+	Status   string     `json:"status"`
+}
+
+// GCResult is the outcome of the garbage collection of an orphaned ACM certificate
+type GCResult struct {
+	Owner   string `json:"owner"`
+	Domain  string `json:"domain"`
+	ARN     string `json:"arn"`
+	Deleted bool   `json:"deleted"`
+	// Marked pending deletion instead of deleted, with a deletion grace period
+	PendingDeletion bool   `json:"pendingDeletion,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+// Split an owner tag value into the kind and the namespaced name of the owner object, false when the tag was not
+// written by the controller, for instance set by hand
+func parseOwnerID(owner string) (string, types.NamespacedName, bool) {
+	parts := strings.Split(owner, "/")
+	if len(parts) != 3 || (parts[0] != "Certificate" && parts[0] != "Secret") || parts[1] == "" || parts[2] == "" {
+		return "", types.NamespacedName{}, false
+	}
+	return parts[0], types.NamespacedName{Namespace: parts[1], Name: parts[2]}, true
+}
+
+// Check if the object an ACM certificate was synced from still exists
+func ownerExists(ctx context.Context, c client.Client, owner string) (bool, error) {
+	kind, key, ok := parseOwnerID(owner)
+	if !ok {
+		return false, fmt.Errorf("invalid owner %q", owner)
+	}
+	var obj client.Object = &certmanagerv1.Certificate{}
+	if kind == "Secret" {
+		obj = &corev1.Secret{}
+	}
+	if err := c.Get(ctx, key, obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// BuildInventory joins the Certificates matching the filters and the certificates imported in AWS ACM
+func BuildInventory(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, filters Filters) ([]InventoryEntry, error) {
+	inventory, err := svc.ListInventory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS ACM inventory: %w", err)
+	}
+	certificates, err := ListMatchingCertificates(ctx, c, filters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Certificates: %w", err)
+	}
+
+	var entries []InventoryEntry
+	joined := map[string]bool{}
+	for i := range certificates {
+		owner := ownerID(&certificates[i])
+		identities, err := certificateIdentities(ctx, c, &certificates[i])
+		if err != nil {
+			return nil, err
+		}
+		imported := getImportedCertificates(&certificates[i])
+		for _, dnsName := range identities {
+			entry := InventoryEntry{Owner: owner, Domain: dnsName, Status: InventoryStatusMissing}
+			for _, item := range inventory {
+				// The ACM copy recorded for the identity, or one imported before the copies were recorded
+				copied := item.ARN == imported[dnsName] || imported[dnsName] == "" && item.DomainName == dnsName
+				if item.Owner == owner && copied {
+					entry.ARN, entry.NotAfter, entry.InUseBy = item.ARN, item.NotAfter, item.InUseBy
+					entry.Status = InventoryStatusSynced
+					joined[item.ARN] = true
+					break
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	// ACM certificates not joined to a matching Certificate
+	for _, item := range inventory {
+		if joined[item.ARN] {
+			continue
+		}
+		entry := InventoryEntry{Owner: item.Owner, Domain: item.DomainName, ARN: item.ARN,
+			NotAfter: item.NotAfter, InUseBy: item.InUseBy, Status: InventoryStatusUnowned}
+		if item.PendingDeletionSince != nil {
+			entry.Status = InventoryStatusPendingDeletion
+		} else if _, _, ok := parseOwnerID(item.Owner); ok {
+			exists, err := ownerExists(ctx, c, item.Owner)
+			if err != nil {
+				return nil, err
+			}
+			entry.Status = InventoryStatusOrphaned
+			if exists {
+				entry.Status = InventoryStatusSynced
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// CollectGarbage deletes the ACM certificates whose owner object no longer exists, or marks them pending deletion
+// with a deletion grace period. Certificates still in use by AWS resources cannot be deleted and are reported as such.
+func CollectGarbage(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService) ([]GCResult, error) {
+	inventory, err := svc.ListInventory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS ACM inventory: %w", err)
+	}
+
+	var results []GCResult
+	for _, item := range inventory {
+		// The certificates pending deletion are deleted by the controller once their grace period elapsed,
+		// and the ones whose owner tag was not written by the controller are left alone
+		if _, _, ok := parseOwnerID(item.Owner); !ok || item.PendingDeletionSince != nil {
+			continue
+		}
+		exists, err := ownerExists(ctx, c, item.Owner)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+
+		result := GCResult{Owner: item.Owner, Domain: item.DomainName, ARN: item.ARN}
+		if svc.DeletionGracePeriod > 0 {
+			if err := svc.MarkPendingDeletion(item.ARN); err != nil && !errors.Is(err, aws_acm_svc.ErrNotFound) {
+				result.Reason = err.Error()
+			} else {
+				result.PendingDeletion = true
+			}
+		} else if len(item.InUseBy) > 0 {
+			result.Reason = fmt.Sprintf("in use by %s", strings.Join(item.InUseBy, ", "))
+		} else if err := svc.DeleteCertificate(item.ARN); err != nil && !errors.Is(err, aws_acm_svc.ErrNotFound) {
+			result.Reason = err.Error()
+		} else {
+			result.Deleted = true
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// AdoptCertificate makes a Certificate the owner of an existing ACM certificate for one of its domains
+func AdoptCertificate(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, key types.NamespacedName, arn string) error {
+	var certificate certmanagerv1.Certificate
+	if err := c.Get(ctx, key, &certificate); err != nil {
+		return fmt.Errorf("failed to get Certificate %s: %w", key, err)
+	}
+
+	item, err := svc.DescribeCertificate(arn)
+	if err != nil {
+		return fmt.Errorf("failed to describe ACM certificate %s: %w", arn, err)
+	}
+	identities, err := certificateIdentities(ctx, c, &certificate)
+	if err != nil {
+		return err
+	}
+	if !containsString(identities, item.DomainName) {
+		return fmt.Errorf("ACM certificate %s is for %s, which is not an identity of Certificate %s",
+			arn, item.DomainName, key)
+	}
+
+	if err := svc.SetCertificateOwner(arn, ownerID(&certificate)); err != nil {
+		return fmt.Errorf("failed to tag ACM certificate %s: %w", arn, err)
+	}
+	if svc.DryRun {
+		return nil
+	}
+	arns := getCertificateARNs(&certificate)
+	if !containsString(arns, arn) {
+		arns = append(arns, arn)
+	}
+	copies := getImportedCertificates(&certificate)
+	copies[item.DomainName] = arn
+	return setAnnotations(ctx, c, &certificate, map[string]string{
+		certificateARNsAnnotation:      strings.Join(arns, ","),
+		importedCertificatesAnnotation: formatImportedCertificates(copies),
+	})
+}
+
+// UninstallResult is the outcome of the release of a synced object by the uninstall
+type UninstallResult struct {
+	Object   string   `json:"object"`
+	Domains  []string `json:"domains,omitempty"`
+	Released bool     `json:"released"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// Uninstall removes the finalizer from every Certificate and Secret carrying it, whatever the filters.
+// When a deletion policy is given, their ACM copies are first released according to it, along with the annotations
+// recording them; otherwise the ACM certificates are left untouched, still tagged with their owner.
+// In dry-run mode, nothing is changed.
+func Uninstall(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, policy DeletionPolicy) ([]UninstallResult, error) {
+	var certificates certmanagerv1.CertificateList
+	if err := c.List(ctx, &certificates); err != nil {
+		return nil, fmt.Errorf("failed to list Certificates: %w", err)
+	}
+	var secrets corev1.SecretList
+	if err := c.List(ctx, &secrets, client.MatchingFields{"type": string(corev1.SecretTypeTLS)}); err != nil {
+		return nil, fmt.Errorf("failed to list Secrets: %w", err)
+	}
+
+	var results []UninstallResult
+	release := func(obj client.Object, dnsNames []string) {
+		if !containsString(obj.GetFinalizers(), certificateFinalizer) {
+			return
+		}
+		result := UninstallResult{Object: ownerID(obj)}
+		if policy != "" {
+			result.Domains = releasedDomains(obj, dnsNames)
+		}
+		var err error
+		switch {
+		case svc.DryRun:
+			// The service only logs the ACM changes, and the objects are left as they are
+			if policy != "" {
+				err = deleteFromACM(svc, nil, obj, dnsNames, policy)
+			}
+		case policy != "":
+			err = releaseFromACM(ctx, c, svc, nil, obj, dnsNames, policy)
+		default:
+			err = removeFinalizer(ctx, c, obj)
+		}
+		if err != nil {
+			result.Reason = err.Error()
+		} else {
+			result.Released = true
+		}
+		results = append(results, result)
+	}
+
+	for i := range certificates.Items {
+		certificate := &certificates.Items[i]
+		identities, err := certificateIdentities(ctx, c, certificate)
+		if err != nil {
+			identities = specIdentities(certificate)
+		}
+		release(certificate, identities)
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		var dnsNames []string
+		if certData, keyData, err := readCertificateData(ctx, c, secret, secret, nil); err == nil && certData != nil {
+			dnsNames, _ = leafIdentitiesFromPEM(certData, keyData)
+		}
+		release(secret, dnsNames)
+	}
+	return results, nil
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseOwnerID(t *testing.T) {
+	tests := []struct {
+		owner string
+		kind  string
+		key   types.NamespacedName
+		ok    bool
+	}{
+		{"Certificate/default/www", "Certificate", types.NamespacedName{Namespace: "default", Name: "www"}, true},
+		{"Secret/default/www-tls", "Secret", types.NamespacedName{Namespace: "default", Name: "www-tls"}, true},
+		{"", "", types.NamespacedName{}, false},
+		{"platform-team", "", types.NamespacedName{}, false},
+		{"team/default/www", "", types.NamespacedName{}, false},
+		{"Certificate//www", "", types.NamespacedName{}, false},
+		{"Certificate/default/www/extra", "", types.NamespacedName{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.owner, func(t *testing.T) {
+			kind, key, ok := parseOwnerID(tc.owner)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.kind, kind)
+			assert.Equal(t, tc.key, key)
+		})
+	}
+}
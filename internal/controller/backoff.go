@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Annotations surfacing, on a synced Certificate or Secret, the consecutive sync failures
+const (
+	failureCountAnnotation = "acm-cmcertificate-sync/failure-count"
+	nextRetryAnnotation    = "acm-cmcertificate-sync/next-retry"
+	lastErrorAnnotation    = "acm-cmcertificate-sync/last-error"
+)
+
+// Exponential backoff of the retries: transient errors (throttling, network, ...) are retried quickly,
+// permanent errors (invalid certificate, rejected by ACM, ...) only in case the cause went away unnoticed
+const (
+	transientBackoffBase = 10 * time.Second
+	transientBackoffCap  = 10 * time.Minute
+	permanentBackoffBase = 10 * time.Minute
+	permanentBackoffCap  = 6 * time.Hour
+)
+
+// Check if an error is permanent: retrying cannot fix it until the certificate or the AWS setup is changed
+func isPermanentError(err error) bool {
+	return errors.Is(err, aws_acm_svc.ErrValidation) ||
+		errors.Is(err, aws_acm_svc.ErrAccessDenied) ||
+		errors.Is(err, aws_acm_svc.ErrLimitExceeded)
+}
+
+// Describe the class of a service error for the events
+func errorClass(err error) string {
+	for class, target := range map[string]error{
+		"throttled":      aws_acm_svc.ErrThrottled,
+		"validation":     aws_acm_svc.ErrValidation,
+		"not found":      aws_acm_svc.ErrNotFound,
+		"in use":         aws_acm_svc.ErrInUse,
+		"limit exceeded": aws_acm_svc.ErrLimitExceeded,
+		"access denied":  aws_acm_svc.ErrAccessDenied,
+		"unavailable":    aws_acm_svc.ErrUnavailable,
+		"circuit open":   aws_acm_svc.ErrCircuitOpen,
+	} {
+		if errors.Is(err, target) {
+			return class
+		}
+	}
+	return "unknown"
+}
+
+// Compute the delay before the next retry after the given number of consecutive failures
+func backoffDelay(failures int, permanent bool) time.Duration {
+	base, limit := transientBackoffBase, transientBackoffCap
+	if permanent {
+		base, limit = permanentBackoffBase, permanentBackoffCap
+	}
+	delay := base
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// Record a failed sync on the object and return the delay before the next retry
+func recordFailure(ctx context.Context, c client.Client, recorder record.EventRecorder, obj client.Object,
+	syncErr error) (time.Duration, error) {
+	failures, _ := strconv.Atoi(obj.GetAnnotations()[failureCountAnnotation])
+	failures++
+	permanent := isPermanentError(syncErr)
+	delay := backoffDelay(failures, permanent)
+
+	kind := "transient"
+	if permanent {
+		kind = "permanent"
+	}
+	recordEvent(recorder, obj, corev1.EventTypeWarning, "SyncFailed",
+		"Failed to sync to AWS ACM (%s %s error, %d consecutive failures, retrying in %s): %v",
+		kind, errorClass(syncErr), failures, delay, syncErr)
+
+	err := setAnnotations(ctx, c, obj, map[string]string{
+		failureCountAnnotation: strconv.Itoa(failures),
+		nextRetryAnnotation:    time.Now().Add(delay).UTC().Format(time.RFC3339),
+		lastErrorAnnotation:    syncErr.Error(),
+	})
+	return delay, err
+}
+
+// Record a failed sync on the object and return the result retrying it with a backoff growing with the consecutive
+// failures, longer for errors retrying cannot fix
+func requeueAfterFailure(ctx context.Context, c client.Client, recorder record.EventRecorder, log logr.Logger,
+	obj client.Object, syncErr error) ctrl.Result {
+	delay, err := recordFailure(ctx, c, recorder, obj, syncErr)
+	if err != nil {
+		log.Error(err, "Failed to record the sync failure")
+	}
+	return ctrl.Result{RequeueAfter: delay}
+}
+
+// Annotations written by the controller on the synced objects
+var ownAnnotations = []string{
+	certificateARNsAnnotation,
+	importedFingerprintAnnotation,
+	importedRevisionAnnotation,
+	importedCertificatesAnnotation,
+	failureCountAnnotation,
+	nextRetryAnnotation,
+	lastErrorAnnotation,
+	rotationWaitSinceAnnotation,
+}
+
+// Predicate ignoring the updates only made of the annotations written by the controller,
+// so that recording a failure does not trigger a reconciliation before the backoff expires
+var ignoreOwnAnnotationsPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !equality.Semantic.DeepEqual(withoutOwnAnnotations(e.ObjectOld), withoutOwnAnnotations(e.ObjectNew))
+	},
+}
+
+// Copy an object without the annotations written by the controller and the fields any patch changes
+func withoutOwnAnnotations(obj client.Object) client.Object {
+	stripped := obj.DeepCopyObject().(client.Object)
+	annotations := map[string]string{}
+	for key, value := range stripped.GetAnnotations() {
+		if !containsString(ownAnnotations, key) {
+			annotations[key] = value
+		}
+	}
+	stripped.SetAnnotations(annotations)
+	stripped.SetResourceVersion("")
+	stripped.SetManagedFields(nil)
+	return stripped
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		permanent bool
+		delay     time.Duration
+	}{
+		{"first transient failure", 1, false, 10 * time.Second},
+		{"second transient failure", 2, false, 20 * time.Second},
+		{"fifth transient failure", 5, false, 160 * time.Second},
+		{"transient cap", 7, false, 10 * time.Minute},
+		{"long after the transient cap", 100, false, 10 * time.Minute},
+		{"first permanent failure", 1, true, 10 * time.Minute},
+		{"third permanent failure", 3, true, 40 * time.Minute},
+		{"permanent cap", 7, true, 6 * time.Hour},
+		{"long after the permanent cap", 100, true, 6 * time.Hour},
+		{"no failure recorded", 0, false, 10 * time.Second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.delay, backoffDelay(tc.failures, tc.permanent))
+		})
+	}
+}
+
+func TestIsPermanentError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"validation", &aws_acm_svc.ValidationError{Reason: "key too short"}, true},
+		{"forceable validation", &aws_acm_svc.ValidationError{Reason: "expired", Cause: aws_acm_svc.ErrInvalidPeriod}, true},
+		{"access denied", fmt.Errorf("import: %w", aws_acm_svc.ErrAccessDenied), true},
+		{"limit exceeded", fmt.Errorf("import: %w", aws_acm_svc.ErrLimitExceeded), true},
+		{"throttled", fmt.Errorf("import: %w", aws_acm_svc.ErrThrottled), false},
+		{"unavailable", fmt.Errorf("import: %w", aws_acm_svc.ErrUnavailable), false},
+		{"circuit open", fmt.Errorf("import: %w", aws_acm_svc.ErrCircuitOpen), false},
+		{"rotation in progress", fmt.Errorf("wait: %w", errRotationInProgress), false},
+		{"unknown", errors.New("boom"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.permanent, isPermanentError(tc.err))
+		})
+	}
+}
+
+func TestIgnoreOwnAnnotationsPredicate(t *testing.T) {
+	certificate := &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-cert", Namespace: "default", ResourceVersion: "1",
+			Annotations: map[string]string{deletionPolicyAnnotation: "Delete"},
+		},
+		Spec: certmanagerv1.CertificateSpec{SecretName: "test-secret", DNSNames: []string{"www.example.com"}},
+	}
+	update := func(change func(*certmanagerv1.Certificate)) event.UpdateEvent {
+		updated := certificate.DeepCopy()
+		updated.ResourceVersion = "2"
+		change(updated)
+		return event.UpdateEvent{ObjectOld: certificate, ObjectNew: updated}
+	}
+
+	tests := []struct {
+		name      string
+		event     event.UpdateEvent
+		reconcile bool
+	}{
+		{"failure recorded", update(func(c *certmanagerv1.Certificate) {
+			c.Annotations[failureCountAnnotation] = "1"
+			c.Annotations[nextRetryAnnotation] = "2026-01-01T00:00:00Z"
+			c.Annotations[lastErrorAnnotation] = "boom"
+		}), false},
+		{"sync recorded", update(func(c *certmanagerv1.Certificate) {
+			c.Annotations[certificateARNsAnnotation] = "arn"
+			c.Annotations[importedCertificatesAnnotation] = "www.example.com=arn"
+			c.Annotations[importedFingerprintAnnotation] = "fingerprint"
+			c.Annotations[importedRevisionAnnotation] = "1"
+		}), false},
+		{"rotation wait recorded", update(func(c *certmanagerv1.Certificate) {
+			c.Annotations[rotationWaitSinceAnnotation] = "2026-01-01T00:00:00Z"
+		}), false},
+		{"only the resource version changed", update(func(c *certmanagerv1.Certificate) {}), false},
+		{"other annotation changed", update(func(c *certmanagerv1.Certificate) {
+			c.Annotations[deletionPolicyAnnotation] = "Retain"
+		}), true},
+		{"force import requested", update(func(c *certmanagerv1.Certificate) {
+			c.Annotations[forceImportAnnotation] = "true"
+		}), true},
+		{"spec changed", update(func(c *certmanagerv1.Certificate) {
+			c.Spec.DNSNames = append(c.Spec.DNSNames, "api.example.com")
+		}), true},
+		{"status changed", update(func(c *certmanagerv1.Certificate) {
+			revision := 2
+			c.Status.Revision = &revision
+		}), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.reconcile, ignoreOwnAnnotationsPredicate.Update(tc.event))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Annotation recording, on a synced Certificate or Secret, the ARNs of its AWS ACM copies
+const certificateARNsAnnotation = "acm-cmcertificate-sync/certificate-arns"
+
+// Read the ARNs recorded on a synced object
+func getCertificateARNs(obj client.Object) []string {
+	value := obj.GetAnnotations()[certificateARNsAnnotation]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Read the ARN of the ACM copy of the first identity recorded on a synced object, empty if it is not synced.
+// The copies of the other identities hold the same certificate: a load balancer only needs one of them.
+func getPrimaryCertificateARN(obj client.Object) string {
+	arns := getCertificateARNs(obj)
+	if len(arns) == 0 {
+		return ""
+	}
+	return arns[0]
+}
+
+// Annotation recording, on a synced Certificate or Secret, the fingerprint of the leaf certificate last imported
+const importedFingerprintAnnotation = "acm-cmcertificate-sync/imported-fingerprint"
+
+// Annotation recording, on a synced Certificate or Secret, the ARN of the ACM copy imported for each of its identities,
+// as comma separated <identity>=<ARN> pairs: ACM only looks certificates up by their first domain name
+const importedCertificatesAnnotation = "acm-cmcertificate-sync/imported-certificates"
+
+// Read the ARNs of the ACM copies recorded on a synced object, by identity
+func getImportedCertificates(obj client.Object) map[string]string {
+	copies := map[string]string{}
+	for _, pair := range strings.Split(obj.GetAnnotations()[importedCertificatesAnnotation], ",") {
+		if identity, arn, found := strings.Cut(pair, "="); found && identity != "" && arn != "" {
+			copies[identity] = arn
+		}
+	}
+	return copies
+}
+
+// Format the ARNs of ACM copies by identity for the imported certificates annotation, sorted by identity
+func formatImportedCertificates(copies map[string]string) string {
+	var pairs []string
+	for identity, arn := range copies {
+		pairs = append(pairs, identity+"="+arn)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// List the distinct ARNs of the ACM copies of the identities, in the order of the identities
+func copiesARNs(identities []string, copies map[string]string) []string {
+	var arns []string
+	for _, identity := range identities {
+		if arn, found := copies[identity]; found && !containsString(arns, arn) {
+			arns = append(arns, arn)
+		}
+	}
+	return arns
+}
+
+// Set annotations on an object, an empty value removing the annotation, patching it only when one of them changed
+func setAnnotations(ctx context.Context, c client.Client, obj client.Object, values map[string]string) error {
+	changed := false
+	for key, value := range values {
+		if current, found := obj.GetAnnotations()[key]; found != (value != "") || current != value {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for key, value := range values {
+		if value == "" {
+			delete(annotations, key)
+		} else {
+			annotations[key] = value
+		}
+	}
+	obj.SetAnnotations(annotations)
+	return c.Patch(ctx, obj, patch)
+}
+
+// Find the ARN of the AWS ACM copy of the first identity of the certificate stored in a Secret, empty if it is not synced,
+// whether the Secret is issued by a Certificate or is a synced plain TLS Secret
+func lookupSecretCertificateARN(ctx context.Context, c client.Client, namespace, secretName string) (string, error) {
+	var certificates certmanagerv1.CertificateList
+	if err := c.List(ctx, &certificates, client.InNamespace(namespace)); err != nil {
+		return "", err
+	}
+	for i := range certificates.Items {
+		if certificates.Items[i].Spec.SecretName == secretName {
+			return getPrimaryCertificateARN(&certificates.Items[i]), nil
+		}
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: secretName}, &secret); err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if !isSyncRequested(&secret) {
+		return "", nil
+	}
+	return getPrimaryCertificateARN(&secret), nil
+}
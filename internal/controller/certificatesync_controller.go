@@ -3,9 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
 	"time"
 
 	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
@@ -13,6 +11,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
@@ -27,45 +26,42 @@ type CertManagerCertificateReconciler struct {
 	Log           logr.Logger
 	Scheme        *runtime.Scheme
 	AWSACMService *aws_acm_svc.AWSACMService
+	Recorder      record.EventRecorder
+	// Interval of the checks that the ACM copies still match the Secret, 0 to disable them
+	DriftCheckInterval time.Duration
+	// Re-import the certificate even when its ACM copies match it
+	ForceImport bool
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertManagerCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	// Fetch namespaces and domain patterns from environment variables
-	watchedNamespaces := os.Getenv("WATCHED_NAMESPACES")
-	domainPatterns := strings.Split(os.Getenv("DOMAIN_PATTERNS"), ",")
+	// Fetch namespaces from environment variables. The domain patterns are matched in Reconcile against the
+	// certificate issued in the Secret, which the spec may not match: a predicate cannot read the Secret.
+	watchedNamespaces := FiltersFromEnv().WatchedNamespaces
 
 	// Create a predicate to filter by namespace
 	namespacePredicate := predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool {
-			return r.namespaceFilter(e.Object.GetNamespace(), watchedNamespaces)
+			return namespaceFilter(e.Object.GetNamespace(), watchedNamespaces)
 		},
 		UpdateFunc: func(e event.UpdateEvent) bool {
-			return r.namespaceFilter(e.ObjectNew.GetNamespace(), watchedNamespaces)
+			return namespaceFilter(e.ObjectNew.GetNamespace(), watchedNamespaces)
 		},
 		DeleteFunc: func(e event.DeleteEvent) bool {
-			return r.namespaceFilter(e.Object.GetNamespace(), watchedNamespaces)
+			return namespaceFilter(e.Object.GetNamespace(), watchedNamespaces)
 		},
 	}
 
-	// Create a predicate to filter by domain patterns
-	domainPredicate := predicate.Funcs{
-		CreateFunc: func(e event.CreateEvent) bool {
-			cert := e.Object.(*certmanagerv1.Certificate)
-			return r.domainPatternFilter(cert.Spec.DNSNames, domainPatterns)
-		},
-		UpdateFunc: func(e event.UpdateEvent) bool {
-			cert := e.ObjectNew.(*certmanagerv1.Certificate)
-			return r.domainPatternFilter(cert.Spec.DNSNames, domainPatterns)
-		},
-		DeleteFunc: func(e event.DeleteEvent) bool {
-			cert := e.Object.(*certmanagerv1.Certificate)
-			return r.domainPatternFilter(cert.Spec.DNSNames, domainPatterns)
-		},
-	}
+	// Certificates still carrying our finalizer pass the filters, to be released once they no longer match them
+	finalizerPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return containsString(obj.GetFinalizers(), certificateFinalizer)
+	})
 
-	// Combine both predicates: namespace and domain pattern
-	combinedPredicate := predicate.And(namespacePredicate, domainPredicate)
+	// Combine the predicates: finalizer or namespace
+	combinedPredicate := predicate.And(
+		predicate.Or(finalizerPredicate, namespacePredicate),
+		ignoreOwnAnnotationsPredicate,
+	)
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&certmanagerv1.Certificate{}).
@@ -73,39 +69,6 @@ func (r *CertManagerCertificateReconciler) SetupWithManager(mgr ctrl.Manager) er
 		Complete(r)
 }
 
-// Helper method to filter namespaces
-func (r *CertManagerCertificateReconciler) namespaceFilter(namespace, watchedNamespaces string) bool {
-	if watchedNamespaces == "" || watchedNamespaces == "all-namespaces" {
-		return true
-	}
-	namespaces := strings.Split(watchedNamespaces, ",")
-	for _, ns := range namespaces {
-		if ns == namespace {
-			return true
-		}
-	}
-	return false
-}
-
-// Helper method to filter by domain patterns
-func (r *CertManagerCertificateReconciler) domainPatternFilter(dnsNames []string, patterns []string) bool {
-	for _, dnsName := range dnsNames {
-		for _, pattern := range patterns {
-			if matchDomainPattern(dnsName, pattern) {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-// Helper function to check if a domain matches the pattern
-func matchDomainPattern(domain, pattern string) bool {
-	// Implement pattern matching (wildcards, etc.) as necessary
-	matched, _ := filepath.Match(pattern, domain)
-	return matched
-}
-
 func (r *CertManagerCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("certificate", req.NamespacedName)
 
@@ -114,13 +77,10 @@ func (r *CertManagerCertificateReconciler) Reconcile(ctx context.Context, req ct
 	if err := r.Get(ctx, req.NamespacedName, &certificate); err != nil {
 		if errors.IsNotFound(err) {
 			log.Info("Certificate resource not found in cluster. Deleting from AWS Certificate Manager.")
-			// Loop over the DNS names in the certificate and delete the certificate for each domain
-			for _, dnsName := range certificate.Spec.DNSNames {
-				err := r.AWSACMService.DeleteCertificateByCommonName(dnsName)
-				if err != nil {
-					log.Error(err, "Failed to delete certificate from AWS ACM")
-					return ctrl.Result{}, err
-				}
+			if err := deleteFromACM(r.AWSACMService, r.Recorder, &certificate, specIdentities(&certificate),
+				deletionPolicy(&certificate)); err != nil {
+				log.Error(err, "Failed to delete certificate from AWS ACM")
+				return ctrl.Result{}, err
 			}
 
 			return ctrl.Result{}, nil
@@ -132,38 +92,57 @@ func (r *CertManagerCertificateReconciler) Reconcile(ctx context.Context, req ct
 	// Check if the certificate is marked for deletion
 	if certificate.GetDeletionTimestamp() != nil {
 		log.Info("Certificate is marked for deletion. Deleting from AWS Certificate Manager.")
-		// Loop over the DNS names in the certificate and delete the certificate for each domain
-		for _, dnsName := range certificate.Spec.DNSNames {
-			err := r.AWSACMService.DeleteCertificateByCommonName(dnsName)
-			if err != nil {
-				log.Error(err, "Failed to delete certificate from AWS ACM")
-				return ctrl.Result{}, err
-			}
+		identities, err := certificateIdentities(ctx, r.Client, &certificate)
+		if err != nil {
+			log.Error(err, "Failed to read the identities of the Certificate")
+			return ctrl.Result{}, err
+		}
+		if err := deleteFromACM(r.AWSACMService, r.Recorder, &certificate, identities,
+			deletionPolicy(&certificate)); err != nil {
+			log.Error(err, "Failed to delete certificate from AWS ACM")
+			return ctrl.Result{}, err
 		}
 
 		// Remove the finalizer after cleanup
-		if err := r.removeFinalizer(&certificate); err != nil {
+		if err := removeFinalizer(ctx, r.Client, &certificate); err != nil {
 			return reconcile.Result{}, err
 		}
 		return ctrl.Result{}, nil
 	}
 
-	// Add the finalizer if it doesn't exist
-	if err := r.addFinalizer(&certificate); err != nil {
-		return reconcile.Result{}, err
+	// The certificate issued in the Secret is the source of truth, the spec may not match it during a rotation
+	identities, err := certificateIdentities(ctx, r.Client, &certificate)
+	if err != nil {
+		log.Error(err, "Failed to read the identities of the Certificate")
+		return ctrl.Result{}, err
 	}
 
-	// Check if the certificate is ready by looking at its conditions
-	isReady := false
-	for _, cond := range certificate.Status.Conditions {
-		if cond.Type == certmanagerv1.CertificateConditionReady && cond.Status == "True" {
-			isReady = true
-			break
+	// The Certificate no longer matches the filters, for instance after they changed: release it
+	if !FiltersFromEnv().Match(certificate.Namespace, identities) {
+		if containsString(certificate.GetFinalizers(), certificateFinalizer) {
+			log.Info("Certificate no longer matches the filters. Releasing it from AWS Certificate Manager.")
+			policy := deletionPolicy(&certificate)
+			if err := releaseFromACM(ctx, r.Client, r.AWSACMService, r.Recorder, &certificate, identities, policy); err != nil {
+				log.Error(err, "Failed to release certificate from AWS ACM")
+				return ctrl.Result{}, err
+			}
+			recordEvent(r.Recorder, &certificate, corev1.EventTypeNormal, "Released",
+				"No longer matches the filters, released from AWS ACM with the %s deletion policy", policy)
+			return ctrl.Result{}, nil
 		}
+		log.V(1).Info("Certificate does not match the filters, skipping reconciliation.", "identities", identities)
+		return ctrl.Result{}, nil
 	}
 
-	if !isReady {
-		log.Info("Certificate is not ready yet, skipping reconciliation.")
+	// Add the finalizer if it doesn't exist
+	if err := addFinalizer(ctx, r.Client, &certificate); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Check if the certificate is issued by looking at its conditions and revision,
+	// the status update ending a reissuance triggers a new reconciliation
+	if !isCertificateIssued(&certificate) {
+		log.Info("Certificate is not issued yet or being reissued, skipping reconciliation.")
 		return ctrl.Result{}, nil
 	}
 
@@ -176,67 +155,83 @@ func (r *CertManagerCertificateReconciler) Reconcile(ctx context.Context, req ct
 	}
 
 	// Extract the certificate, private key, and certificate chain from the secret
-	certData, certExists := secret.Data["tls.crt"]
-	keyData, keyExists := secret.Data["tls.key"]
+	certData, keyData, err := readCertificateData(ctx, r.Client, &certificate, &secret, certificate.Spec.Keystores)
+	if err != nil {
+		log.Error(err, "Failed to read the certificate data from the Secret")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+	}
 
-	if !certExists || !keyExists {
+	if certData == nil || keyData == nil {
 		log.Error(fmt.Errorf("secret data missing required fields"), "Secret does not contain required certificate data")
 		return ctrl.Result{}, nil
 	}
 
-	// Import the certificate into AWS ACM
-	// Loop over the DNS names in the certificate and import the certificate for each domain
-	for _, dnsName := range certificate.Spec.DNSNames {
-		if err := r.AWSACMService.ImportOrUpdateCertificate(dnsName, string(certData), string(keyData)); err != nil {
-			log.Error(err, "Failed to import certificate to AWS ACM")
-			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	// Only import a certificate cert-manager reports as issued: the Secret may hold a new key with the old certificate
+	// in the middle of a rotation. A Secret which cannot be read is not a rotation, it fails like any invalid certificate.
+	if err := checkIssuedCertificate(&certificate, certData, keyData); err != nil {
+		if !isRotationInProgress(err) {
+			log.Error(err, "Failed to read the certificate of the Secret")
+			return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+		}
+		return waitForRotation(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+	}
+	if !isRevisionAdvanced(&certificate) {
+		fingerprint, err := aws_acm_svc.Fingerprint(string(certData), string(keyData))
+		if err != nil {
+			log.Error(err, "Failed to read the certificate of the Secret")
+			return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+		}
+		if fingerprint != certificate.GetAnnotations()[importedFingerprintAnnotation] {
+			return waitForRotation(ctx, r.Client, r.Recorder, log, &certificate,
+				fmt.Errorf("secret certificate changed without a new Certificate revision: %w", errRotationInProgress)), nil
 		}
 	}
 
-	log.Info("Successfully imported certificate to AWS ACM")
-	return ctrl.Result{}, nil
-}
+	// Build the certificate chain from the configured CA bundle and preferred issuer
+	chain, err := readChainOptions(ctx, r.Client, &certificate, &secret)
+	if err != nil {
+		log.Error(err, "Failed to read the certificate chain source")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+	}
 
-const certificateFinalizer = "acm-cmcertificate-sync/finalizer"
+	// Import the certificate into AWS ACM
+	copies, err := syncToACM(r.AWSACMService, r.Recorder, &certificate, identities, certData, keyData, chain, r.ForceImport)
+	if err != nil {
+		log.Error(err, "Failed to import certificate to AWS ACM")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
+	}
 
-// Add the finalizer to the certificate if it doesn't exist
-func (r *CertManagerCertificateReconciler) addFinalizer(cert *certmanagerv1.Certificate) error {
-	if !containsString(cert.GetFinalizers(), certificateFinalizer) {
-		cert.SetFinalizers(append(cert.GetFinalizers(), certificateFinalizer))
-		if err := r.Update(context.TODO(), cert); err != nil {
-			return err
-		}
+	// Release the ACM copies of the domains the certificate no longer has
+	if err := releaseRemovedDomains(r.AWSACMService, r.Recorder, &certificate, identities); err != nil {
+		log.Error(err, "Failed to release the AWS ACM certificates of removed domains")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &certificate, err), nil
 	}
-	return nil
-}
 
-// Remove the finalizer from the certificate
-func (r *CertManagerCertificateReconciler) removeFinalizer(cert *certmanagerv1.Certificate) error {
-	if containsString(cert.GetFinalizers(), certificateFinalizer) {
-		cert.SetFinalizers(removeString(cert.GetFinalizers(), certificateFinalizer))
-		if err := r.Update(context.TODO(), cert); err != nil {
-			return err
+	// Record the ARNs so that the load balancer integrations can reference them,
+	// and the fingerprint and domains of the imported certificate to detect drifts and removals
+	if err := recordSync(ctx, r.Client, r.AWSACMService, &certificate, identities, copies, certData, keyData); err != nil {
+		log.Error(err, "Failed to record AWS ACM certificate ARNs")
+		return ctrl.Result{}, err
+	}
+	if !r.AWSACMService.DryRun {
+		revision := strconv.Itoa(*certificate.Status.Revision)
+		if err := setAnnotations(ctx, r.Client, &certificate, map[string]string{importedRevisionAnnotation: revision}); err != nil {
+			log.Error(err, "Failed to record the imported Certificate revision")
+			return ctrl.Result{}, err
 		}
 	}
-	return nil
+
+	log.Info("Successfully synced certificate to AWS ACM")
+	// Check again later that the ACM copies did not drift
+	return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
 }
 
-// Helper functions for handling finalizers
-func containsString(slice []string, s string) bool {
-	for _, item := range slice {
-		if item == s {
+// Check if the certificate is ready by looking at its conditions
+func isCertificateReady(certificate *certmanagerv1.Certificate) bool {
+	for _, cond := range certificate.Status.Conditions {
+		if cond.Type == certmanagerv1.CertificateConditionReady && cond.Status == "True" {
 			return true
 		}
 	}
 	return false
 }
-
-func removeString(slice []string, s string) []string {
-	var result []string
-	for _, item := range slice {
-		if item != s {
-			result = append(result, item)
-		}
-	}
-	return result
-}
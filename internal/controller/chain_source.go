@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Annotation selecting, on a synced Certificate or Secret, where the certificate chain is completed from,
+// defaulting to the CHAIN_SOURCE environment variable:
+//   - "" or "none": only the certificates of tls.crt
+//   - "ca.crt": the ca.crt key of the Secret
+//   - "configmap:<name>[/<key>]" or "secret:<name>[/<key>]": a CA bundle of the same namespace,
+//     such as a trust-manager Bundle target, the key defaulting to ca.crt
+const chainSourceAnnotation = "acm-cmcertificate-sync/chain-source"
+
+// Annotation selecting, on a synced Certificate or Secret, the common name of the issuer the certificate chain should
+// end at when cross-signed certificates offer alternate chains, defaulting to the PREFERRED_CHAIN environment variable
+const preferredChainAnnotation = "acm-cmcertificate-sync/preferred-chain"
+
+// Read the options building the certificate chain of a synced object
+func readChainOptions(ctx context.Context, c client.Client, obj client.Object, secret *corev1.Secret) (aws_acm_svc.ChainOptions, error) {
+	caBundle, err := readChainBundle(ctx, c, obj, secret)
+	if err != nil {
+		return aws_acm_svc.ChainOptions{}, err
+	}
+	preferredIssuer, found := obj.GetAnnotations()[preferredChainAnnotation]
+	if !found {
+		preferredIssuer = os.Getenv("PREFERRED_CHAIN")
+	}
+	return aws_acm_svc.ChainOptions{CABundle: string(caBundle), PreferredIssuer: preferredIssuer}, nil
+}
+
+// Read the CA bundle the certificate chain of a synced object is completed from, empty if there is none
+func readChainBundle(ctx context.Context, c client.Client, obj client.Object, secret *corev1.Secret) ([]byte, error) {
+	source, found := obj.GetAnnotations()[chainSourceAnnotation]
+	if !found {
+		source = os.Getenv("CHAIN_SOURCE")
+	}
+
+	switch {
+	case source == "" || source == "none":
+		return nil, nil
+	case source == cmmeta.TLSCAKey:
+		return secret.Data[cmmeta.TLSCAKey], nil
+	case strings.HasPrefix(source, "configmap:"):
+		name, key := splitChainSourceReference(strings.TrimPrefix(source, "configmap:"))
+		var configMap corev1.ConfigMap
+		if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, &configMap); err != nil {
+			return nil, fmt.Errorf("failed to get chain source ConfigMap %s/%s: %w", obj.GetNamespace(), name, err)
+		}
+		if data, found := configMap.Data[key]; found {
+			return []byte(data), nil
+		}
+		return nil, fmt.Errorf("chain source ConfigMap %s/%s has no %s key", obj.GetNamespace(), name, key)
+	case strings.HasPrefix(source, "secret:"):
+		name, key := splitChainSourceReference(strings.TrimPrefix(source, "secret:"))
+		var bundleSecret corev1.Secret
+		if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, &bundleSecret); err != nil {
+			return nil, fmt.Errorf("failed to get chain source Secret %s/%s: %w", obj.GetNamespace(), name, err)
+		}
+		if data, found := bundleSecret.Data[key]; found {
+			return data, nil
+		}
+		return nil, fmt.Errorf("chain source Secret %s/%s has no %s key", obj.GetNamespace(), name, key)
+	}
+	return nil, fmt.Errorf("invalid chain source %q", source)
+}
+
+// Split a <name>[/<key>] chain source reference, the key defaulting to ca.crt
+func splitChainSourceReference(reference string) (string, string) {
+	name, key, found := strings.Cut(reference, "/")
+	if !found || key == "" {
+		key = cmmeta.TLSCAKey
+	}
+	return name, key
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Annotation selecting, on a synced Certificate or Secret, what happens to its ACM copies once they are no longer
+// needed, defaulting to the DELETION_POLICY environment variable:
+//   - "Delete" (default): the ACM certificates are deleted, once the deletion grace period elapsed if there is one
+//   - "Retain": the ACM certificates are kept, and their owner tag removed so that they are not garbage collected
+const deletionPolicyAnnotation = "acm-cmcertificate-sync/deletion-policy"
+
+// DeletionPolicy tells what happens to the ACM copies of a synced object once they are no longer needed
+type DeletionPolicy string
+
+const (
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+// ParseDeletionPolicy parses a deletion policy, empty for none
+func ParseDeletionPolicy(value string) (DeletionPolicy, error) {
+	switch {
+	case value == "" || strings.EqualFold(value, "none"):
+		return "", nil
+	case strings.EqualFold(value, string(DeletionPolicyDelete)):
+		return DeletionPolicyDelete, nil
+	case strings.EqualFold(value, string(DeletionPolicyRetain)):
+		return DeletionPolicyRetain, nil
+	}
+	return "", fmt.Errorf("invalid deletion policy %q, expected Delete, Retain or none", value)
+}
+
+// Get the deletion policy of a synced object
+func deletionPolicy(obj client.Object) DeletionPolicy {
+	policy, found := obj.GetAnnotations()[deletionPolicyAnnotation]
+	if !found {
+		policy = os.Getenv("DELETION_POLICY")
+	}
+	if strings.EqualFold(policy, string(DeletionPolicyRetain)) {
+		return DeletionPolicyRetain
+	}
+	return DeletionPolicyDelete
+}
+
+// Read the domains whose ACM copies are recorded on a synced object
+func getImportedDomains(obj client.Object) []string {
+	var domains []string
+	for domain := range getImportedCertificates(obj) {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// List the domains whose ACM copies are released with a synced object: its current DNS names and the ones
+// recorded as imported
+func releasedDomains(obj client.Object, dnsNames []string) []string {
+	domains := append([]string(nil), dnsNames...)
+	for _, domain := range getImportedDomains(obj) {
+		if !containsString(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// Release the ACM copies imported for domains the synced object no longer has, according to its deletion policy
+func releaseRemovedDomains(svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder, obj client.Object,
+	dnsNames []string) error {
+	imported := getImportedCertificates(obj)
+	for _, domain := range getImportedDomains(obj) {
+		if containsString(dnsNames, domain) {
+			continue
+		}
+		if err := releaseACMCertificate(svc, recorder, obj, domain, imported[domain], deletionPolicy(obj)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the ACM copies released with a synced object, by domain: the ones recorded as imported, and the ones found by
+// their domain name for its current DNS names without a recorded copy, imported before the copies were recorded
+func releasedCopies(svc *aws_acm_svc.AWSACMService, obj client.Object, dnsNames []string) (map[string]string, error) {
+	copies := getImportedCertificates(obj)
+	for _, dnsName := range dnsNames {
+		if _, found := copies[dnsName]; found {
+			continue
+		}
+		certSummary, err := svc.FindCertificateForDomain(dnsName)
+		if err != nil {
+			return nil, err
+		}
+		if certSummary != nil {
+			copies[dnsName] = aws.StringValue(certSummary.CertificateArn)
+		}
+	}
+	return copies, nil
+}
+
+// Release the ACM copy imported by a synced object for a domain, by its ARN, according to a deletion policy,
+// unless it was taken over by another object
+func releaseACMCertificate(svc *aws_acm_svc.AWSACMService, recorder record.EventRecorder, obj client.Object,
+	domain string, arn string, policy DeletionPolicy) error {
+	owner, err := svc.GetCertificateOwner(arn)
+	if err != nil {
+		if errors.Is(err, aws_acm_svc.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if owner != ownerID(obj) {
+		return nil
+	}
+
+	if policy == DeletionPolicyRetain {
+		if err := svc.RemoveCertificateOwner(arn); err != nil {
+			return err
+		}
+		if svc.DryRun {
+			recordEvent(recorder, obj, corev1.EventTypeNormal, "DryRunRetain",
+				"Dry run: would retain AWS ACM certificate %s for domain %s", arn, domain)
+			return nil
+		}
+		recordEvent(recorder, obj, corev1.EventTypeNormal, "CertificateRetained",
+			"Retained AWS ACM certificate %s for domain %s, it is no longer synced", arn, domain)
+		return nil
+	}
+
+	// The deletion is delayed, in case the object was deleted by mistake and comes back
+	if svc.DeletionGracePeriod > 0 {
+		if err := svc.MarkPendingDeletion(arn); err != nil {
+			return err
+		}
+		if svc.DryRun {
+			recordEvent(recorder, obj, corev1.EventTypeNormal, "DryRunScheduleDeletion",
+				"Dry run: would schedule the deletion of AWS ACM certificate %s for domain %s", arn, domain)
+			return nil
+		}
+		recordEvent(recorder, obj, corev1.EventTypeNormal, "DeletionScheduled",
+			"AWS ACM certificate %s for domain %s will be deleted in %s, unless it is synced again",
+			arn, domain, svc.DeletionGracePeriod)
+		return nil
+	}
+
+	if err := svc.DeleteCertificate(arn); err != nil {
+		if errors.Is(err, aws_acm_svc.ErrNotFound) {
+			return nil
+		}
+		if errors.Is(err, aws_acm_svc.ErrInUse) {
+			recordEvent(recorder, obj, corev1.EventTypeWarning, "CertificateInUse",
+				"AWS ACM certificate %s for domain %s cannot be deleted while in use by AWS resources", arn, domain)
+		}
+		return err
+	}
+	if svc.DryRun {
+		recordEvent(recorder, obj, corev1.EventTypeNormal, "DryRunDelete",
+			"Dry run: would delete AWS ACM certificate %s for domain %s", arn, domain)
+	}
+	return nil
+}
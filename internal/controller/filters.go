@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Filters select the namespaces and domains synced to AWS ACM
+type Filters struct {
+	// Comma separated list of namespaces, empty or "all-namespaces" to watch them all
+	WatchedNamespaces string
+	// Patterns (path.Match syntax) one of the domains of a certificate must match
+	DomainPatterns []string
+}
+
+// FiltersFromEnv reads the filters from the WATCHED_NAMESPACES and DOMAIN_PATTERNS environment variables
+func FiltersFromEnv() Filters {
+	return Filters{
+		WatchedNamespaces: os.Getenv("WATCHED_NAMESPACES"),
+		DomainPatterns:    strings.Split(os.Getenv("DOMAIN_PATTERNS"), ","),
+	}
+}
+
+// Match checks if a certificate for these domains, in this namespace, must be synced
+func (f Filters) Match(namespace string, dnsNames []string) bool {
+	return namespaceFilter(namespace, f.WatchedNamespaces) && domainPatternFilter(dnsNames, f.DomainPatterns)
+}
+
+// Helper function to filter namespaces
+func namespaceFilter(namespace, watchedNamespaces string) bool {
+	if watchedNamespaces == "" || watchedNamespaces == "all-namespaces" {
+		return true
+	}
+	namespaces := strings.Split(watchedNamespaces, ",")
+	for _, ns := range namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to filter by domain patterns
+func domainPatternFilter(dnsNames []string, patterns []string) bool {
+	for _, dnsName := range dnsNames {
+		for _, pattern := range patterns {
+			if matchDomainPattern(dnsName, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Helper function to check if a domain matches the pattern
+func matchDomainPattern(domain, pattern string) bool {
+	// Implement pattern matching (wildcards, etc.) as necessary
+	matched, _ := filepath.Match(pattern, domain)
+	return matched
+}
@@ -0,0 +1,309 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// Annotation publishing, on an opted-in Gateway, the ARN of the synced certificate of each TLS listener,
+// as comma separated <listener name>=<ARN> pairs
+const gatewayListenerCertificateARNsAnnotation = "acm-cmcertificate-sync/listener-certificate-arns"
+
+// Annotation opting a Gateway in to the ARNs being also written in the listener TLS option read by the
+// AWS Gateway API Controller. The listeners are then changed, which GitOps tools owning the Gateway would revert.
+const gatewayWriteListenerOptionsAnnotation = "acm-cmcertificate-sync/write-listener-options"
+
+// Listener TLS option read by the AWS Gateway API Controller to attach an ACM certificate to a listener
+const gatewayListenerCertificateARNOption = "application-networking.k8s.aws/certificate-arn"
+
+// Listener status condition reporting whether the Secrets referenced by the listener are synced to AWS ACM
+const gatewayListenerCertificateSyncedCondition = "acm-cmcertificate-sync/CertificateSynced"
+
+// GatewayReconciler publishes the ARNs of the synced certificates of the listeners of opted-in Gateways
+type GatewayReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	watchedNamespaces := os.Getenv("WATCHED_NAMESPACES")
+
+	gatewayPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return namespaceFilter(obj.GetNamespace(), watchedNamespaces) &&
+			obj.GetAnnotations()[injectCertificateARNAnnotation] == "true"
+	})
+
+	// The ARNs are recorded on the Certificates and Secrets: follow their changes
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("gateway").
+		For(&gatewayv1.Gateway{}, builder.WithPredicates(gatewayPredicate)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				return r.gatewaysForSecret(ctx, obj.GetNamespace(), obj.(*certmanagerv1.Certificate).Spec.SecretName)
+			})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				return r.gatewaysForSecret(ctx, obj.GetNamespace(), obj.GetName())
+			}), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return isSyncRequested(obj.(*corev1.Secret))
+		}))).
+		Watches(&gatewayv1beta1.ReferenceGrant{}, handler.EnqueueRequestsFromMapFunc(r.gatewaysForReferenceGrant)).
+		Complete(r)
+}
+
+// Return the namespaced name of the Secret a listener certificate reference points to, if it is a Secret
+func listenerSecretRef(gateway *gatewayv1.Gateway, ref gatewayv1.SecretObjectReference) (types.NamespacedName, bool) {
+	if ref.Group != nil && *ref.Group != "" {
+		return types.NamespacedName{}, false
+	}
+	if ref.Kind != nil && *ref.Kind != "Secret" {
+		return types.NamespacedName{}, false
+	}
+	namespace := gateway.Namespace
+	if ref.Namespace != nil {
+		namespace = string(*ref.Namespace)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: string(ref.Name)}, true
+}
+
+// Check if a Gateway may reference a Secret: Secrets from other namespaces must be granted by a ReferenceGrant
+func referenceGranted(ctx context.Context, c client.Client, gateway *gatewayv1.Gateway, secret types.NamespacedName) (bool, error) {
+	if secret.Namespace == gateway.Namespace {
+		return true, nil
+	}
+	var grants gatewayv1beta1.ReferenceGrantList
+	if err := c.List(ctx, &grants, client.InNamespace(secret.Namespace)); err != nil {
+		return false, err
+	}
+	for _, grant := range grants.Items {
+		from := false
+		for _, f := range grant.Spec.From {
+			if f.Group == gatewayv1.GroupName && f.Kind == "Gateway" && string(f.Namespace) == gateway.Namespace {
+				from = true
+				break
+			}
+		}
+		if !from {
+			continue
+		}
+		for _, to := range grant.Spec.To {
+			if to.Group == "" && to.Kind == "Secret" && (to.Name == nil || string(*to.Name) == secret.Name) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// List the opted-in Gateways of the namespaces a ReferenceGrant trusts
+func (r *GatewayReconciler) gatewaysForReferenceGrant(ctx context.Context, obj client.Object) []reconcile.Request {
+	grant := obj.(*gatewayv1beta1.ReferenceGrant)
+	var requests []reconcile.Request
+	for _, from := range grant.Spec.From {
+		if from.Group != gatewayv1.GroupName || from.Kind != "Gateway" {
+			continue
+		}
+		var gateways gatewayv1.GatewayList
+		if err := r.List(ctx, &gateways, client.InNamespace(string(from.Namespace))); err != nil {
+			r.Log.Error(err, "Failed to list Gateways")
+			return nil
+		}
+		for _, gateway := range gateways.Items {
+			if gateway.GetAnnotations()[injectCertificateARNAnnotation] == "true" {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: gateway.Namespace, Name: gateway.Name},
+				})
+			}
+		}
+	}
+	return requests
+}
+
+// List the opted-in Gateways with a listener referencing the Secret
+func (r *GatewayReconciler) gatewaysForSecret(ctx context.Context, namespace, secretName string) []reconcile.Request {
+	// Listeners can reference Secrets from other namespaces through ReferenceGrants
+	var gateways gatewayv1.GatewayList
+	if err := r.List(ctx, &gateways); err != nil {
+		r.Log.Error(err, "Failed to list Gateways")
+		return nil
+	}
+
+	secret := types.NamespacedName{Namespace: namespace, Name: secretName}
+	var requests []reconcile.Request
+	for i := range gateways.Items {
+		gateway := &gateways.Items[i]
+		if gateway.GetAnnotations()[injectCertificateARNAnnotation] != "true" {
+			continue
+		}
+	listeners:
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.TLS == nil {
+				continue
+			}
+			for _, ref := range listener.TLS.CertificateRefs {
+				if ref, ok := listenerSecretRef(gateway, ref); ok && ref == secret {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{Namespace: gateway.Namespace, Name: gateway.Name},
+					})
+					break listeners
+				}
+			}
+		}
+	}
+	return requests
+}
+
+func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("gateway", req.NamespacedName)
+
+	var gateway gatewayv1.Gateway
+	if err := r.Get(ctx, req.NamespacedName, &gateway); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Gateway")
+		return ctrl.Result{}, err
+	}
+
+	if gateway.GetAnnotations()[injectCertificateARNAnnotation] != "true" {
+		return ctrl.Result{}, nil
+	}
+
+	// Resolve, for each TLS listener, the ARN of the first synced Secret it references
+	listenerARNs := map[gatewayv1.SectionName]string{}
+	unsyncedSecrets := map[gatewayv1.SectionName][]string{}
+	notPermittedSecrets := map[gatewayv1.SectionName][]string{}
+	for _, listener := range gateway.Spec.Listeners {
+		if listener.TLS == nil {
+			continue
+		}
+		for _, ref := range listener.TLS.CertificateRefs {
+			secret, ok := listenerSecretRef(&gateway, ref)
+			if !ok {
+				continue
+			}
+			granted, err := referenceGranted(ctx, r.Client, &gateway, secret)
+			if err != nil {
+				log.Error(err, "Failed to check the ReferenceGrants", "secret", secret)
+				return ctrl.Result{}, err
+			}
+			if !granted {
+				notPermittedSecrets[listener.Name] = append(notPermittedSecrets[listener.Name], secret.String())
+				continue
+			}
+			arn, err := lookupSecretCertificateARN(ctx, r.Client, secret.Namespace, secret.Name)
+			if err != nil {
+				log.Error(err, "Failed to look up AWS ACM certificate ARN", "secret", secret)
+				return ctrl.Result{}, err
+			}
+			if arn == "" {
+				unsyncedSecrets[listener.Name] = append(unsyncedSecrets[listener.Name], secret.String())
+				continue
+			}
+			if _, found := listenerARNs[listener.Name]; !found {
+				listenerARNs[listener.Name] = arn
+			}
+		}
+	}
+
+	// Publish the ARNs in an annotation: the listeners are owned by the Gateway manifest, which GitOps tools would revert
+	listenerNames := make([]string, 0, len(listenerARNs))
+	for name := range listenerARNs {
+		listenerNames = append(listenerNames, string(name))
+	}
+	sort.Strings(listenerNames)
+	var published []string
+	for _, name := range listenerNames {
+		published = append(published, name+"="+listenerARNs[gatewayv1.SectionName(name)])
+	}
+	if err := setAnnotations(ctx, r.Client, &gateway, map[string]string{
+		gatewayListenerCertificateARNsAnnotation: strings.Join(published, ","),
+	}); err != nil {
+		log.Error(err, "Failed to patch Gateway listeners certificate ARNs annotation")
+		return ctrl.Result{}, err
+	}
+
+	// Write the ARNs in the listeners TLS options, where the AWS Gateway API Controller reads them
+	if gateway.GetAnnotations()[gatewayWriteListenerOptionsAnnotation] == "true" {
+		patch := client.MergeFromWithOptions(gateway.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		changed := false
+		for i := range gateway.Spec.Listeners {
+			listener := &gateway.Spec.Listeners[i]
+			arn, found := listenerARNs[listener.Name]
+			if !found || listener.TLS.Options[gatewayListenerCertificateARNOption] == gatewayv1.AnnotationValue(arn) {
+				continue
+			}
+			if listener.TLS.Options == nil {
+				listener.TLS.Options = map[gatewayv1.AnnotationKey]gatewayv1.AnnotationValue{}
+			}
+			listener.TLS.Options[gatewayListenerCertificateARNOption] = gatewayv1.AnnotationValue(arn)
+			changed = true
+		}
+		if changed {
+			if err := r.Patch(ctx, &gateway, patch); err != nil {
+				log.Error(err, "Failed to patch Gateway listeners certificate ARN option")
+				return ctrl.Result{}, err
+			}
+			log.Info("Updated Gateway listeners certificate ARN option")
+		}
+	}
+
+	// Report on the listeners status whether their Secrets are synced
+	statusPatch := client.MergeFromWithOptions(gateway.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	statusChanged := false
+	for i := range gateway.Status.Listeners {
+		status := &gateway.Status.Listeners[i]
+		condition := metav1.Condition{
+			Type:               gatewayListenerCertificateSyncedCondition,
+			ObservedGeneration: gateway.Generation,
+		}
+		if secrets, found := notPermittedSecrets[status.Name]; found {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "RefNotPermitted"
+			condition.Message = fmt.Sprintf("Secrets from other namespaces not granted by a ReferenceGrant: %v", secrets)
+		} else if secrets, found := unsyncedSecrets[status.Name]; found {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "SecretNotSynced"
+			condition.Message = fmt.Sprintf("Secrets not synced to AWS ACM: %v", secrets)
+		} else if _, found := listenerARNs[status.Name]; found {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "Synced"
+			condition.Message = "Listener certificate is synced to AWS ACM"
+		} else {
+			continue
+		}
+		if meta.SetStatusCondition(&status.Conditions, condition) {
+			statusChanged = true
+		}
+	}
+	if statusChanged {
+		if err := r.Status().Patch(ctx, &gateway, statusPatch); err != nil {
+			log.Error(err, "Failed to patch Gateway listeners status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
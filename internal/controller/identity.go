@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Return the identities a leaf certificate is valid for: its DNS names, its common name and its IP addresses
+func leafIdentities(leaf *x509.Certificate) []string {
+	var identities []string
+	for _, dnsName := range leaf.DNSNames {
+		identities = appendIdentity(identities, dnsName)
+	}
+	identities = appendIdentity(identities, leaf.Subject.CommonName)
+	for _, ip := range leaf.IPAddresses {
+		identities = appendIdentity(identities, ip.String())
+	}
+	return identities
+}
+
+// Parse the leaf certificate and return the identities it is valid for
+func leafIdentitiesFromPEM(certData, keyData []byte) ([]string, error) {
+	leaf, err := parseLeaf(certData, keyData)
+	if err != nil {
+		return nil, err
+	}
+	return leafIdentities(leaf), nil
+}
+
+// Return the identities requested by the spec of a Certificate, used until its Secret holds a certificate
+func specIdentities(certificate *certmanagerv1.Certificate) []string {
+	var identities []string
+	for _, dnsName := range certificate.Spec.DNSNames {
+		identities = appendIdentity(identities, dnsName)
+	}
+	identities = appendIdentity(identities, certificate.Spec.CommonName)
+	for _, ip := range certificate.Spec.IPAddresses {
+		identities = appendIdentity(identities, ip)
+	}
+	return identities
+}
+
+// Return the identities of a Certificate, read from the leaf certificate of its Secret,
+// or from its spec when the Secret holds no usable certificate
+func certificateIdentities(ctx context.Context, c client.Client, certificate *certmanagerv1.Certificate) ([]string, error) {
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: certificate.Namespace, Name: certificate.Spec.SecretName}
+	if err := c.Get(ctx, key, &secret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return specIdentities(certificate), nil
+		}
+		return nil, fmt.Errorf("failed to get Secret %s: %w", key, err)
+	}
+	return secretIdentities(ctx, c, certificate, &secret), nil
+}
+
+// Return the identities of a Certificate read from its Secret, from its spec when the Secret holds no usable certificate
+func secretIdentities(ctx context.Context, c client.Client, certificate *certmanagerv1.Certificate, secret *corev1.Secret) []string {
+	certData, keyData, err := readCertificateData(ctx, c, certificate, secret, certificate.Spec.Keystores)
+	if err != nil || certData == nil {
+		return specIdentities(certificate)
+	}
+	identities, err := leafIdentitiesFromPEM(certData, keyData)
+	if err != nil || len(identities) == 0 {
+		return specIdentities(certificate)
+	}
+	return identities
+}
+
+// Append an identity if it is not empty nor already in the list
+func appendIdentity(identities []string, identity string) []string {
+	if identity == "" || containsString(identities, identity) {
+		return identities
+	}
+	return append(identities, identity)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Annotation an Ingress or a Gateway must carry (set to "true") to get the ARNs of its synced TLS Secrets
+const injectCertificateARNAnnotation = "acm-cmcertificate-sync/inject-certificate-arn"
+
+// Annotation read by the AWS Load Balancer Controller to attach ACM certificates to an ALB
+const albCertificateARNAnnotation = "alb.ingress.kubernetes.io/certificate-arn"
+
+// IngressReconciler writes the ARNs of the synced certificates into the ALB annotation of opted-in Ingresses
+type IngressReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	watchedNamespaces := os.Getenv("WATCHED_NAMESPACES")
+
+	ingressPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return namespaceFilter(obj.GetNamespace(), watchedNamespaces) &&
+			obj.GetAnnotations()[injectCertificateARNAnnotation] == "true"
+	})
+
+	// The ARNs are recorded on the Certificates and Secrets: follow their changes
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("ingress").
+		For(&networkingv1.Ingress{}, builder.WithPredicates(ingressPredicate)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				return r.ingressesForSecret(ctx, obj.GetNamespace(), obj.(*certmanagerv1.Certificate).Spec.SecretName)
+			})).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(
+			func(ctx context.Context, obj client.Object) []reconcile.Request {
+				return r.ingressesForSecret(ctx, obj.GetNamespace(), obj.GetName())
+			}), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return isSyncRequested(obj.(*corev1.Secret))
+		}))).
+		Complete(r)
+}
+
+// List the opted-in Ingresses that reference the Secret in their TLS configuration
+func (r *IngressReconciler) ingressesForSecret(ctx context.Context, namespace, secretName string) []reconcile.Request {
+	var ingresses networkingv1.IngressList
+	if err := r.List(ctx, &ingresses, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "Failed to list Ingresses", "namespace", namespace)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ingress := range ingresses.Items {
+		if ingress.GetAnnotations()[injectCertificateARNAnnotation] != "true" {
+			continue
+		}
+		for _, tls := range ingress.Spec.TLS {
+			if tls.SecretName == secretName {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: ingress.Namespace, Name: ingress.Name},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("ingress", req.NamespacedName)
+
+	var ingress networkingv1.Ingress
+	if err := r.Get(ctx, req.NamespacedName, &ingress); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Ingress")
+		return ctrl.Result{}, err
+	}
+
+	if ingress.GetAnnotations()[injectCertificateARNAnnotation] != "true" {
+		return ctrl.Result{}, nil
+	}
+
+	// Gather one ARN per synced Secret referenced by the Ingress, so as not to fill the listener certificate quota
+	// with copies of the same certificate
+	var arns []string
+	for _, tls := range ingress.Spec.TLS {
+		if tls.SecretName == "" {
+			continue
+		}
+		arn, err := lookupSecretCertificateARN(ctx, r.Client, ingress.Namespace, tls.SecretName)
+		if err != nil {
+			log.Error(err, "Failed to look up AWS ACM certificate ARN", "secret", tls.SecretName)
+			return ctrl.Result{}, err
+		}
+		if arn != "" && !containsString(arns, arn) {
+			arns = append(arns, arn)
+		}
+	}
+
+	// Nothing synced yet: keep whatever the annotation currently holds
+	if len(arns) == 0 {
+		log.Info("No synced certificate referenced by the Ingress yet, skipping reconciliation.")
+		return ctrl.Result{}, nil
+	}
+
+	value := strings.Join(arns, ",")
+	if ingress.GetAnnotations()[albCertificateARNAnnotation] == value {
+		return ctrl.Result{}, nil
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopy())
+	ingress.Annotations[albCertificateARNAnnotation] = value
+	if err := r.Patch(ctx, &ingress, patch); err != nil {
+		log.Error(err, "Failed to patch Ingress certificate ARN annotation")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Updated Ingress certificate ARN annotation", "certificateArns", value)
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	driftDetectedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "acm_cmcertificate_sync_drift_detected_total",
+			Help: "Number of AWS ACM certificates found different from the Secret they were imported from",
+		},
+	)
+)
+
+func init() {
+	// Register the metrics with the controller-runtime registry, served by the manager metrics endpoint
+	metrics.Registry.MustRegister(driftDetectedTotal)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Interval of the sweeps of the ACM certificates pending deletion
+const pendingDeletionSweepInterval = 10 * time.Minute
+
+// PendingDeletionSweeper deletes the ACM certificates marked pending deletion once the deletion grace period elapsed.
+// Until then, an object syncing the domain again takes the certificate back, removing its pending deletion tag.
+type PendingDeletionSweeper struct {
+	Log           logr.Logger
+	AWSACMService PendingDeletionService
+	// DeletionGracePeriod is the time the certificates stay pending deletion, the one of the AWS ACM service
+	DeletionGracePeriod time.Duration
+	// Once runs a single sweep, deleting the certificates left pending deletion when the grace period was set back
+	// to 0, without reading the whole ACM inventory every interval for a disabled feature
+	Once bool
+}
+
+// PendingDeletionService is the part of the AWS ACM service used by the sweeper
+type PendingDeletionService interface {
+	ListInventory() ([]aws_acm_svc.InventoryItem, error)
+	DescribeCertificate(certificateArn string) (*aws_acm_svc.InventoryItem, error)
+	DeleteCertificate(certificateArn string) error
+}
+
+// Start runs the sweeps until the context is done, it is meant to be added to the manager
+func (s *PendingDeletionSweeper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(pendingDeletionSweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(ctx); err != nil {
+			s.Log.Error(err, "Failed to sweep the AWS ACM certificates pending deletion")
+		}
+		if s.Once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes the ACM certificates whose deletion grace period elapsed.
+// The tags of each certificate are read again right before it is deleted, in case it was taken back in the meantime.
+// Certificates still in use by AWS resources are kept until the next sweep.
+func (s *PendingDeletionSweeper) Sweep(ctx context.Context) error {
+	inventory, err := s.AWSACMService.ListInventory()
+	if err != nil {
+		return fmt.Errorf("failed to read AWS ACM inventory: %w", err)
+	}
+
+	for _, item := range inventory {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if item.PendingDeletionSince == nil {
+			continue
+		}
+		log := s.Log.WithValues("certificateArn", item.ARN, "domain", item.DomainName, "owner", item.Owner)
+
+		if time.Since(*item.PendingDeletionSince) < s.DeletionGracePeriod {
+			continue
+		}
+
+		// The inventory may be stale: the certificate may have been taken back since it was read
+		current, err := s.AWSACMService.DescribeCertificate(item.ARN)
+		if err != nil {
+			if errors.Is(err, aws_acm_svc.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		if current.PendingDeletionSince == nil {
+			log.Info("AWS ACM certificate pending deletion was taken back, keeping it")
+			continue
+		}
+		if time.Since(*current.PendingDeletionSince) < s.DeletionGracePeriod {
+			continue
+		}
+		item = *current
+		if len(item.InUseBy) > 0 {
+			log.Info("AWS ACM certificate pending deletion is still in use, keeping it", "inUseBy", item.InUseBy)
+			continue
+		}
+		if err := s.AWSACMService.DeleteCertificate(item.ARN); err != nil && !errors.Is(err, aws_acm_svc.ErrNotFound) {
+			if errors.Is(err, aws_acm_svc.ErrInUse) {
+				log.Info("AWS ACM certificate pending deletion is still in use, keeping it")
+				continue
+			}
+			return err
+		}
+		log.Info("Deleted AWS ACM certificate after its deletion grace period",
+			"pendingDeletionSince", item.PendingDeletionSince)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Fake AWS ACM service of the sweeper: the inventory it lists, and the current state of the certificates it describes
+type fakePendingDeletionService struct {
+	inventory []aws_acm_svc.InventoryItem
+	current   map[string]*aws_acm_svc.InventoryItem
+	deleteErr map[string]error
+	deleted   []string
+}
+
+func (f *fakePendingDeletionService) ListInventory() ([]aws_acm_svc.InventoryItem, error) {
+	return f.inventory, nil
+}
+
+func (f *fakePendingDeletionService) DescribeCertificate(certificateArn string) (*aws_acm_svc.InventoryItem, error) {
+	item, found := f.current[certificateArn]
+	if !found {
+		return nil, fmt.Errorf("describe %s: %w", certificateArn, aws_acm_svc.ErrNotFound)
+	}
+	return item, nil
+}
+
+func (f *fakePendingDeletionService) DeleteCertificate(certificateArn string) error {
+	if err := f.deleteErr[certificateArn]; err != nil {
+		return err
+	}
+	f.deleted = append(f.deleted, certificateArn)
+	return nil
+}
+
+// Build an ACM certificate marked pending deletion for the given time, nil for one that is not
+func pendingItem(arn string, pendingFor *time.Duration, inUseBy ...string) *aws_acm_svc.InventoryItem {
+	item := &aws_acm_svc.InventoryItem{ARN: arn, DomainName: "www.example.com", InUseBy: inUseBy}
+	if pendingFor != nil {
+		since := time.Now().Add(-*pendingFor)
+		item.PendingDeletionSince = &since
+	}
+	return item
+}
+
+func TestPendingDeletionSweeperSweep(t *testing.T) {
+	hour, day := time.Hour, 24*time.Hour
+	tests := []struct {
+		name        string
+		listed      *aws_acm_svc.InventoryItem
+		current     *aws_acm_svc.InventoryItem
+		gracePeriod time.Duration
+		deleteErr   error
+		deleted     bool
+		wantErr     bool
+	}{
+		{"not pending deletion", pendingItem("arn", nil), pendingItem("arn", nil), hour, nil, false, false},
+		{"grace period not elapsed", pendingItem("arn", &hour), pendingItem("arn", &hour), day, nil, false, false},
+		{"grace period elapsed", pendingItem("arn", &day), pendingItem("arn", &day), hour, nil, true, false},
+		{"no grace period", pendingItem("arn", &hour), pendingItem("arn", &hour), 0, nil, true, false},
+		{"taken back since listed", pendingItem("arn", &day), pendingItem("arn", nil), hour, nil, false, false},
+		{"marked again since listed", pendingItem("arn", &day), pendingItem("arn", &hour), day / 2, nil, false, false},
+		{"deleted since listed", pendingItem("arn", &day), nil, hour, nil, false, false},
+		{"in use", pendingItem("arn", &day), pendingItem("arn", &day, "arn:aws:elasticloadbalancing:lb"), hour, nil,
+			false, false},
+		{"in use when deleted", pendingItem("arn", &day), pendingItem("arn", &day), hour,
+			fmt.Errorf("delete: %w", aws_acm_svc.ErrInUse), false, false},
+		{"deletion failed", pendingItem("arn", &day), pendingItem("arn", &day), hour,
+			fmt.Errorf("delete: %w", aws_acm_svc.ErrUnavailable), false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &fakePendingDeletionService{
+				inventory: []aws_acm_svc.InventoryItem{*tc.listed},
+				current:   map[string]*aws_acm_svc.InventoryItem{},
+				deleteErr: map[string]error{"arn": tc.deleteErr},
+			}
+			if tc.current != nil {
+				service.current["arn"] = tc.current
+			}
+			sweeper := &PendingDeletionSweeper{Log: logr.Discard(), AWSACMService: service, DeletionGracePeriod: tc.gracePeriod}
+
+			err := sweeper.Sweep(context.Background())
+			if tc.wantErr {
+				assert.True(t, errors.Is(err, aws_acm_svc.ErrUnavailable), "expected ErrUnavailable, got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.deleted {
+				assert.Equal(t, []string{"arn"}, service.deleted)
+			} else {
+				assert.Empty(t, service.deleted)
+			}
+		})
+	}
+}
+
+func TestPendingDeletionSweeperSweepOnce(t *testing.T) {
+	day := 24 * time.Hour
+	service := &fakePendingDeletionService{
+		inventory: []aws_acm_svc.InventoryItem{*pendingItem("arn", &day)},
+		current:   map[string]*aws_acm_svc.InventoryItem{"arn": pendingItem("arn", &day)},
+	}
+	sweeper := &PendingDeletionSweeper{Log: logr.Discard(), AWSACMService: service, Once: true}
+
+	// A single sweep: Start returns without waiting for the context
+	assert.NoError(t, sweeper.Start(context.Background()))
+	assert.Equal(t, []string{"arn"}, service.deleted)
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Actions the controller would perform in AWS ACM
+const (
+	PlanActionCreate = "create"
+	PlanActionUpdate = "update"
+	PlanActionDelete = "delete"
+	PlanActionRetain = "retain"
+	PlanActionAdopt  = "adopt"
+)
+
+// PlanAction is a change the controller would perform in AWS ACM for a domain of a Certificate
+type PlanAction struct {
+	Action string `json:"action"`
+	Owner  string `json:"owner"`
+	Domain string `json:"domain"`
+	ARN    string `json:"arn,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// BuildPlan diffs the Certificates matching the filters against the certificates imported in AWS ACM
+// and returns the actions the controller would perform to reconcile them
+func BuildPlan(ctx context.Context, c client.Client, svc *aws_acm_svc.AWSACMService, filters Filters) ([]PlanAction, error) {
+	inventory, err := svc.ListInventory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS ACM inventory: %w", err)
+	}
+	byARN := map[string]aws_acm_svc.InventoryItem{}
+	byDomain := map[string]aws_acm_svc.InventoryItem{}
+	for _, item := range inventory {
+		byARN[item.ARN] = item
+		if _, found := byDomain[item.DomainName]; !found {
+			byDomain[item.DomainName] = item
+		}
+	}
+
+	var certificates certmanagerv1.CertificateList
+	if err := c.List(ctx, &certificates); err != nil {
+		return nil, fmt.Errorf("failed to list Certificates: %w", err)
+	}
+
+	var actions []PlanAction
+	existingOwners := map[string]bool{}
+	for i := range certificates.Items {
+		certificate := &certificates.Items[i]
+		owner := ownerID(certificate)
+		existingOwners[owner] = true
+		identities, err := certificateIdentities(ctx, c, certificate)
+		if err != nil {
+			return nil, err
+		}
+		// The finalizer makes the controller release the ACM copies of a deleted Certificate,
+		// or of a Certificate which no longer matches the filters
+		releaseAction := PlanActionDelete
+		if deletionPolicy(certificate) == DeletionPolicyRetain {
+			releaseAction = PlanActionRetain
+		}
+		releaseReason := ""
+		switch {
+		case certificate.GetDeletionTimestamp() != nil:
+			releaseReason = "Certificate is being deleted"
+		case !filters.Match(certificate.Namespace, identities):
+			if !containsString(certificate.GetFinalizers(), certificateFinalizer) {
+				continue
+			}
+			releaseReason = "Certificate no longer matches the filters"
+		}
+		imported := getImportedCertificates(certificate)
+		if releaseReason != "" {
+			for _, dnsName := range releasedDomains(certificate, identities) {
+				// The ACM copy recorded for the domain, otherwise the one found by its domain name
+				item, found := byARN[imported[dnsName]]
+				if _, recorded := imported[dnsName]; !recorded {
+					item, found = byDomain[dnsName]
+				}
+				if found && item.Owner == owner {
+					actions = append(actions, PlanAction{Action: releaseAction, Owner: owner, Domain: dnsName,
+						ARN: item.ARN, Reason: releaseReason})
+				}
+			}
+			continue
+		}
+
+		// The controller waits for the Certificate to be issued
+		if !isCertificateIssued(certificate) {
+			continue
+		}
+		serial, err := secretLeafSerial(ctx, c, certificate)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dnsName := range identities {
+			// The ACM copy recorded for the identity, otherwise the ACM certificate the controller would adopt
+			item, found := byARN[imported[dnsName]]
+			if !found {
+				item, found = byDomain[dnsName]
+			}
+			switch {
+			case !found:
+				actions = append(actions, PlanAction{Action: PlanActionCreate, Owner: owner, Domain: dnsName,
+					Reason: "no ACM certificate for the domain"})
+			case item.Owner != owner:
+				reason := "ACM certificate is not tagged with an owner"
+				if item.Owner != "" {
+					reason = fmt.Sprintf("ACM certificate is owned by %s", item.Owner)
+				}
+				actions = append(actions, PlanAction{Action: PlanActionAdopt, Owner: owner, Domain: dnsName,
+					ARN: item.ARN, Reason: reason})
+			case serial != "" && aws_acm_svc.NormalizeSerial(item.Serial) != serial:
+				actions = append(actions, PlanAction{Action: PlanActionUpdate, Owner: owner, Domain: dnsName,
+					ARN: item.ARN, Reason: "serial differs from the Secret certificate"})
+			}
+		}
+
+		// The ACM copies of the domains removed from the certificate are released
+		for _, dnsName := range getImportedDomains(certificate) {
+			if item, found := byARN[imported[dnsName]]; found && item.Owner == owner && !containsString(identities, dnsName) {
+				actions = append(actions, PlanAction{Action: releaseAction, Owner: owner, Domain: dnsName,
+					ARN: item.ARN, Reason: "domain removed from the certificate"})
+			}
+		}
+	}
+
+	// ACM copies whose Certificate disappeared without the finalizer being run
+	for _, item := range inventory {
+		if item.PendingDeletionSince != nil {
+			continue
+		}
+		if strings.HasPrefix(item.Owner, "Certificate/") && !existingOwners[item.Owner] {
+			actions = append(actions, PlanAction{Action: PlanActionDelete, Owner: item.Owner, Domain: item.DomainName,
+				ARN: item.ARN, Reason: "owner Certificate no longer exists"})
+		}
+	}
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Owner != actions[j].Owner {
+			return actions[i].Owner < actions[j].Owner
+		}
+		return actions[i].Domain < actions[j].Domain
+	})
+	return actions, nil
+}
+
+// Read the normalized serial of the leaf certificate stored in the Secret of a Certificate, empty if the Secret is not usable
+func secretLeafSerial(ctx context.Context, c client.Client, certificate *certmanagerv1.Certificate) (string, error) {
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: certificate.Namespace, Name: certificate.Spec.SecretName}
+	if err := c.Get(ctx, key, &secret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get Secret %s: %w", key, err)
+	}
+	certData, keyData, err := readCertificateData(ctx, c, certificate, &secret, certificate.Spec.Keystores)
+	if err != nil || certData == nil {
+		return "", nil
+	}
+	leaf, err := parseLeaf(certData, keyData)
+	if err != nil {
+		return "", nil
+	}
+	return aws_acm_svc.NormalizeSerial(leaf.SerialNumber.Text(16)), nil
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Annotation recording, on a synced Certificate, the cert-manager revision of the certificate last imported
+const importedRevisionAnnotation = "acm-cmcertificate-sync/imported-revision"
+
+// Delay before checking again a Secret caught in the middle of a rotation, whose updates do not trigger a reconciliation
+const rotationRequeueDelay = 10 * time.Second
+
+// Time the Secret certificate may not match the Certificate status before the rotation is reported as failed
+const rotationWaitTimeout = 5 * time.Minute
+
+// Annotation recording, on a synced Certificate, since when its Secret certificate does not match its status
+const rotationWaitSinceAnnotation = "acm-cmcertificate-sync/rotation-wait-since"
+
+// Error matched with errors.Is when the Secret certificate does not match the Certificate status yet
+var errRotationInProgress = errors.New("rotation in progress")
+
+// Check if the issuance of a Certificate is complete: it is ready, has a revision, and is not being reissued
+func isCertificateIssued(certificate *certmanagerv1.Certificate) bool {
+	if !isCertificateReady(certificate) || certificate.Status.Revision == nil {
+		return false
+	}
+	for _, cond := range certificate.Status.Conditions {
+		if cond.Type == certmanagerv1.CertificateConditionIssuing {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if the revision of a Certificate advanced since the certificate last imported, true if none was
+func isRevisionAdvanced(certificate *certmanagerv1.Certificate) bool {
+	imported, err := strconv.Atoi(certificate.GetAnnotations()[importedRevisionAnnotation])
+	if err != nil {
+		return true
+	}
+	return certificate.Status.Revision != nil && *certificate.Status.Revision > imported
+}
+
+// Check if the current revision of a Certificate is the one recorded as imported
+func isRevisionImported(certificate *certmanagerv1.Certificate) bool {
+	imported := certificate.GetAnnotations()[importedRevisionAnnotation]
+	return certificate.Status.Revision != nil && imported == strconv.Itoa(*certificate.Status.Revision)
+}
+
+// Check that the certificate of the Secret is the one cert-manager reports as issued, and not half of a rotation
+func checkIssuedCertificate(certificate *certmanagerv1.Certificate, certData, keyData []byte) error {
+	if certificate.Status.NotAfter == nil {
+		return nil
+	}
+	leaf, err := parseLeaf(certData, keyData)
+	if err != nil {
+		return err
+	}
+	if !leaf.NotAfter.Equal(certificate.Status.NotAfter.Time) {
+		return fmt.Errorf("secret certificate expires on %s, while the Certificate status reports %s: %w",
+			leaf.NotAfter.UTC().Format(time.RFC3339), certificate.Status.NotAfter.UTC().Format(time.RFC3339),
+			errRotationInProgress)
+	}
+	return nil
+}
+
+// Check if an error is the Secret certificate not matching the Certificate status yet
+func isRotationInProgress(err error) bool {
+	return errors.Is(err, errRotationInProgress)
+}
+
+// Wait for the rotation in progress of a Certificate to complete: check again shortly, until the Secret certificate
+// has not matched the Certificate status for rotationWaitTimeout, which is then recorded as a failed sync
+func waitForRotation(ctx context.Context, c client.Client, recorder record.EventRecorder, log logr.Logger,
+	certificate *certmanagerv1.Certificate, reason error) ctrl.Result {
+	since, err := time.Parse(time.RFC3339, certificate.GetAnnotations()[rotationWaitSinceAnnotation])
+	if err != nil {
+		since = time.Now()
+		if err := setAnnotations(ctx, c, certificate, map[string]string{
+			rotationWaitSinceAnnotation: since.UTC().Format(time.RFC3339),
+		}); err != nil {
+			log.Error(err, "Failed to record the start of the rotation")
+		}
+	}
+	if time.Since(since) < rotationWaitTimeout {
+		log.Info("Secret certificate does not match the Certificate status yet, waiting for the rotation to complete.",
+			"reason", reason.Error())
+		return ctrl.Result{RequeueAfter: rotationRequeueDelay}
+	}
+	return requeueAfterFailure(ctx, c, recorder, log, certificate,
+		fmt.Errorf("secret certificate still does not match the Certificate status after %s: %w", rotationWaitTimeout, reason))
+}
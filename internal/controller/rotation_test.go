@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Build a Certificate with the given revision and status conditions
+func certificateWithStatus(revision *int, conditions ...certmanagerv1.CertificateCondition) *certmanagerv1.Certificate {
+	return &certmanagerv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cert", Namespace: "default"},
+		Status:     certmanagerv1.CertificateStatus{Revision: revision, Conditions: conditions},
+	}
+}
+
+// Generate a self-signed certificate expiring at notAfter, PEM encoded along with its private key
+func generateCertificate(t *testing.T, commonName string, notAfter time.Time) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestIsCertificateIssued(t *testing.T) {
+	revision := 2
+	ready := certmanagerv1.CertificateCondition{Type: certmanagerv1.CertificateConditionReady, Status: cmmeta.ConditionTrue}
+	notReady := certmanagerv1.CertificateCondition{Type: certmanagerv1.CertificateConditionReady, Status: cmmeta.ConditionFalse}
+	issuing := certmanagerv1.CertificateCondition{Type: certmanagerv1.CertificateConditionIssuing, Status: cmmeta.ConditionTrue}
+
+	tests := []struct {
+		name        string
+		certificate *certmanagerv1.Certificate
+		issued      bool
+	}{
+		{"ready with a revision", certificateWithStatus(&revision, ready), true},
+		{"no conditions", certificateWithStatus(&revision), false},
+		{"not ready", certificateWithStatus(&revision, notReady), false},
+		{"no revision", certificateWithStatus(nil, ready), false},
+		{"issuing", certificateWithStatus(&revision, ready, issuing), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.issued, isCertificateIssued(tc.certificate))
+		})
+	}
+}
+
+func TestIsRevisionAdvanced(t *testing.T) {
+	revision := 3
+	tests := []struct {
+		name     string
+		revision *int
+		imported string
+		advanced bool
+	}{
+		{"never imported", &revision, "", true},
+		{"unreadable imported revision", &revision, "invalid", true},
+		{"new revision", &revision, "2", true},
+		{"same revision", &revision, "3", false},
+		{"older revision", &revision, "4", false},
+		{"no revision", nil, "2", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			certificate := certificateWithStatus(tc.revision)
+			if tc.imported != "" {
+				certificate.Annotations = map[string]string{importedRevisionAnnotation: tc.imported}
+			}
+			assert.Equal(t, tc.advanced, isRevisionAdvanced(certificate))
+		})
+	}
+}
+
+func TestCheckIssuedCertificate(t *testing.T) {
+	notAfter := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second)
+	certData, keyData := generateCertificate(t, "www.example.com", notAfter)
+	// A rotation in progress: the Secret holds the previous certificate first, then the issued one
+	previousCertData, previousKeyData := generateCertificate(t, "www.example.com", notAfter.Add(-30*24*time.Hour))
+
+	tests := []struct {
+		name     string
+		notAfter *metav1.Time
+		certData []byte
+		keyData  []byte
+		wantErr  string
+		rotation bool
+	}{
+		{"no status notAfter", nil, []byte("not a certificate"), nil, "", false},
+		{"issued certificate", &metav1.Time{Time: notAfter}, certData, keyData, "", false},
+		{"issued certificate after another one", &metav1.Time{Time: notAfter},
+			append(append([]byte(nil), previousCertData...), certData...), keyData, "", false},
+		{"previous certificate", &metav1.Time{Time: notAfter}, previousCertData, previousKeyData,
+			"secret certificate expires on", true},
+		{"key of another certificate", &metav1.Time{Time: notAfter}, certData, previousKeyData,
+			"no certificate matches the private key", false},
+		{"unparsable certificate", &metav1.Time{Time: notAfter}, []byte("not a certificate"), keyData,
+			"no PEM encoded certificate found", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			certificate := certificateWithStatus(nil)
+			certificate.Status.NotAfter = tc.notAfter
+			err := checkIssuedCertificate(certificate, tc.certData, tc.keyData)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+				assert.Equal(t, tc.rotation, isRotationInProgress(err), "rotation in progress")
+			}
+		})
+	}
+}
+
+func TestIsRevisionImported(t *testing.T) {
+	revision := 3
+	tests := []struct {
+		name     string
+		revision *int
+		imported string
+		want     bool
+	}{
+		{"current revision imported", &revision, "3", true},
+		{"previous revision imported", &revision, "2", false},
+		{"never imported", &revision, "", false},
+		{"no revision", nil, "3", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			certificate := certificateWithStatus(tc.revision)
+			certificate.Annotations = map[string]string{importedRevisionAnnotation: tc.imported}
+			assert.Equal(t, tc.want, isRevisionImported(certificate))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Annotation a kubernetes.io/tls Secret must carry (set to "true") to be synced to AWS ACM
+const syncSecretAnnotation = "acm-cmcertificate-sync/sync"
+
+// Annotation set by cert-manager on the Secrets it manages
+const certManagerCertificateNameAnnotation = "cert-manager.io/certificate-name"
+
+// TLSSecretReconciler syncs plain kubernetes.io/tls Secrets, that are not managed by cert-manager, to AWS ACM
+type TLSSecretReconciler struct {
+	client.Client
+	Log           logr.Logger
+	Scheme        *runtime.Scheme
+	AWSACMService *aws_acm_svc.AWSACMService
+	Recorder      record.EventRecorder
+	// Interval of the checks that the ACM copies still match the Secret, 0 to disable them
+	DriftCheckInterval time.Duration
+	// Re-import the certificate even when its ACM copies match it
+	ForceImport bool
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TLSSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	watchedNamespaces := os.Getenv("WATCHED_NAMESPACES")
+
+	// Only TLS Secrets that opted in in the watched namespaces, or that still carry our finalizer to be released
+	secretPredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		secret, ok := obj.(*corev1.Secret)
+		if !ok || secret.Type != corev1.SecretTypeTLS {
+			return false
+		}
+		if containsString(secret.GetFinalizers(), certificateFinalizer) {
+			return true
+		}
+		return namespaceFilter(secret.GetNamespace(), watchedNamespaces) && isSyncRequested(secret)
+	})
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("tlssecret").
+		For(&corev1.Secret{}).
+		WithEventFilter(predicate.And(secretPredicate, ignoreOwnAnnotationsPredicate)).
+		Complete(r)
+}
+
+// Check if the Secret opted in to the sync and is not managed by cert-manager
+func isSyncRequested(secret *corev1.Secret) bool {
+	if _, managed := secret.GetAnnotations()[certManagerCertificateNameAnnotation]; managed {
+		return false
+	}
+	return secret.GetAnnotations()[syncSecretAnnotation] == "true"
+}
+
+func (r *TLSSecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("secret", req.NamespacedName)
+
+	var secret corev1.Secret
+	if err := r.Get(ctx, req.NamespacedName, &secret); err != nil {
+		if errors.IsNotFound(err) {
+			// The finalizer guarantees the cleanup already happened
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Secret")
+		return ctrl.Result{}, err
+	}
+
+	certData, keyData, err := readCertificateData(ctx, r.Client, &secret, &secret, nil)
+	if err != nil {
+		log.Error(err, "Failed to read the certificate data from the Secret")
+	}
+
+	var dnsNames []string
+	if certData != nil {
+		names, err := leafIdentitiesFromPEM(certData, keyData)
+		if err != nil {
+			log.Error(err, "Failed to read the identities of the Secret certificate")
+		}
+		dnsNames = names
+	}
+
+	// The Secret is being deleted or opted out: delete the ACM copies and release it
+	if secret.GetDeletionTimestamp() != nil || !isSyncRequested(&secret) {
+		if !containsString(secret.GetFinalizers(), certificateFinalizer) {
+			return ctrl.Result{}, nil
+		}
+		log.Info("Secret is deleted or no longer synced. Deleting from AWS Certificate Manager.")
+		if err := deleteFromACM(r.AWSACMService, r.Recorder, &secret, dnsNames,
+			deletionPolicy(&secret)); err != nil {
+			log.Error(err, "Failed to delete certificate from AWS ACM")
+			return ctrl.Result{}, err
+		}
+		if err := removeFinalizer(ctx, r.Client, &secret); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if certData == nil || keyData == nil || len(dnsNames) == 0 {
+		log.Error(fmt.Errorf("secret data missing required fields"), "Secret does not contain required certificate data")
+		return ctrl.Result{}, nil
+	}
+
+	// The Secret no longer matches the filters, for instance after they changed: release it
+	if !FiltersFromEnv().Match(secret.Namespace, dnsNames) {
+		if containsString(secret.GetFinalizers(), certificateFinalizer) {
+			log.Info("Secret no longer matches the filters. Releasing it from AWS Certificate Manager.")
+			policy := deletionPolicy(&secret)
+			if err := releaseFromACM(ctx, r.Client, r.AWSACMService, r.Recorder, &secret, dnsNames, policy); err != nil {
+				log.Error(err, "Failed to release certificate from AWS ACM")
+				return ctrl.Result{}, err
+			}
+			recordEvent(r.Recorder, &secret, corev1.EventTypeNormal, "Released",
+				"No longer matches the filters, released from AWS ACM with the %s deletion policy", policy)
+			return ctrl.Result{}, nil
+		}
+		log.Info("Secret certificate does not match the filters, skipping reconciliation.", "dnsNames", dnsNames)
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer if it doesn't exist
+	if err := addFinalizer(ctx, r.Client, &secret); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Build the certificate chain from the configured CA bundle and preferred issuer
+	chain, err := readChainOptions(ctx, r.Client, &secret, &secret)
+	if err != nil {
+		log.Error(err, "Failed to read the certificate chain source")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &secret, err), nil
+	}
+
+	// Import the certificate into AWS ACM
+	copies, err := syncToACM(r.AWSACMService, r.Recorder, &secret, dnsNames, certData, keyData, chain, r.ForceImport)
+	if err != nil {
+		log.Error(err, "Failed to import certificate to AWS ACM")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &secret, err), nil
+	}
+
+	// Release the ACM copies of the domains the certificate no longer has
+	if err := releaseRemovedDomains(r.AWSACMService, r.Recorder, &secret, dnsNames); err != nil {
+		log.Error(err, "Failed to release the AWS ACM certificates of removed domains")
+		return requeueAfterFailure(ctx, r.Client, r.Recorder, log, &secret, err), nil
+	}
+
+	// Record the ARNs so that the load balancer integrations can reference them,
+	// and the fingerprint and domains of the imported certificate to detect drifts and removals
+	if err := recordSync(ctx, r.Client, r.AWSACMService, &secret, dnsNames, copies, certData, keyData); err != nil {
+		log.Error(err, "Failed to record AWS ACM certificate ARNs")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Successfully synced certificate to AWS ACM")
+	// Check again later that the ACM copies did not drift
+	return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	aws_acm_svc "github.com/NicolasEspiau-stilll/acm-cmcertificate-sync.git/internal/services"
+)
+
+// Annotations selecting, on a synced Certificate or Secret, the Secret data keys of the PEM encoded certificate
+// and private key, defaulting to the CERTIFICATE_DATA_KEY and PRIVATE_KEY_DATA_KEY environment variables, then to
+// tls.crt and tls.key
+const (
+	certificateDataKeyAnnotation = "acm-cmcertificate-sync/certificate-data-key"
+	privateKeyDataKeyAnnotation  = "acm-cmcertificate-sync/private-key-data-key"
+)
+
+// Read the PEM encoded certificate and private key of a synced object from its Secret. When they are missing from the
+// configured keys, they are read from the additional outputs of cert-manager: the CombinedPEM and DER formats, and the
+// PKCS#12 keystore whose password is referenced by the Certificate keystores (nil for a plain Secret).
+// Returns nil data when the Secret carries no usable certificate or key.
+func readCertificateData(ctx context.Context, c client.Client, obj client.Object, secret *corev1.Secret,
+	keystores *certmanagerv1.CertificateKeystores) ([]byte, []byte, error) {
+	var pkcs12Password func() (string, error)
+	if keystores != nil && keystores.PKCS12 != nil {
+		pkcs12Password = func() (string, error) {
+			password, err := readSecretKey(ctx, c, secret.Namespace, keystores.PKCS12.PasswordSecretRef.Name,
+				keystores.PKCS12.PasswordSecretRef.Key)
+			return string(password), err
+		}
+	}
+	return aws_acm_svc.ReadCertificateData(secret.Data,
+		dataKey(obj, certificateDataKeyAnnotation, "CERTIFICATE_DATA_KEY", corev1.TLSCertKey),
+		dataKey(obj, privateKeyDataKeyAnnotation, "PRIVATE_KEY_DATA_KEY", corev1.TLSPrivateKeyKey),
+		pkcs12Password)
+}
+
+// Get the Secret data key configured by an annotation of the object, or an environment variable, or the default one
+func dataKey(obj client.Object, annotation string, env string, defaultKey string) string {
+	if key := obj.GetAnnotations()[annotation]; key != "" {
+		return key
+	}
+	if key := os.Getenv(env); key != "" {
+		return key
+	}
+	return defaultKey
+}
+
+// Read a data key of a Secret. A missing Secret or key is a validation error, retrying cannot fix it.
+func readSecretKey(ctx context.Context, c client.Client, namespace, name, key string) ([]byte, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &secret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			return nil, &aws_acm_svc.ValidationError{Reason: fmt.Sprintf("secret %s/%s not found", namespace, name)}
+		}
+		return nil, fmt.Errorf("failed to get Secret %s/%s: %w", namespace, name, err)
+	}
+	data, found := secret.Data[key]
+	if !found {
+		return nil, &aws_acm_svc.ValidationError{Reason: fmt.Sprintf("secret %s/%s has no %s key", namespace, name, key)}
+	}
+	return data, nil
+}
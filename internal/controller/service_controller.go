@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"os"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Annotation linking a Service to the Certificate, in the same namespace, whose ARNs it must get
+const serviceCertificateAnnotation = "acm-cmcertificate-sync/certificate"
+
+// Annotation read by the AWS cloud provider and the AWS Load Balancer Controller to attach ACM certificates to an NLB
+const nlbSSLCertAnnotation = "service.beta.kubernetes.io/aws-load-balancer-ssl-cert"
+
+// ServiceReconciler writes the ARNs of a synced Certificate into the SSL certificate annotation of linked Services
+type ServiceReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	watchedNamespaces := os.Getenv("WATCHED_NAMESPACES")
+
+	servicePredicate := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return namespaceFilter(obj.GetNamespace(), watchedNamespaces) &&
+			obj.GetAnnotations()[serviceCertificateAnnotation] != ""
+	})
+
+	// The ARNs are recorded on the Certificates: follow their changes
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("service").
+		For(&corev1.Service{}, builder.WithPredicates(servicePredicate)).
+		Watches(&certmanagerv1.Certificate{}, handler.EnqueueRequestsFromMapFunc(r.servicesForCertificate)).
+		Complete(r)
+}
+
+// List the Services linked to the Certificate
+func (r *ServiceReconciler) servicesForCertificate(ctx context.Context, obj client.Object) []reconcile.Request {
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list Services", "namespace", obj.GetNamespace())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, service := range services.Items {
+		if service.GetAnnotations()[serviceCertificateAnnotation] == obj.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: service.Namespace, Name: service.Name},
+			})
+		}
+	}
+	return requests
+}
+
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("service", req.NamespacedName)
+
+	var service corev1.Service
+	if err := r.Get(ctx, req.NamespacedName, &service); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Service")
+		return ctrl.Result{}, err
+	}
+
+	certificateName := service.GetAnnotations()[serviceCertificateAnnotation]
+	if certificateName == "" {
+		return ctrl.Result{}, nil
+	}
+
+	var certificate certmanagerv1.Certificate
+	if err := r.Get(ctx, client.ObjectKey{Namespace: service.Namespace, Name: certificateName}, &certificate); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Linked Certificate not found, skipping reconciliation.", "certificate", certificateName)
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get linked Certificate", "certificate", certificateName)
+		return ctrl.Result{}, err
+	}
+
+	// Nothing synced yet: keep whatever the annotation currently holds.
+	// A single ARN: the copies of the other identities hold the same certificate.
+	value := getPrimaryCertificateARN(&certificate)
+	if value == "" {
+		log.Info("Linked Certificate is not synced yet, skipping reconciliation.", "certificate", certificateName)
+		return ctrl.Result{}, nil
+	}
+
+	if service.GetAnnotations()[nlbSSLCertAnnotation] == value {
+		return ctrl.Result{}, nil
+	}
+
+	patch := client.MergeFrom(service.DeepCopy())
+	service.Annotations[nlbSSLCertAnnotation] = value
+	if err := r.Patch(ctx, &service, patch); err != nil {
+		log.Error(err, "Failed to patch Service SSL certificate annotation")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Updated Service SSL certificate annotation", "certificateArn", value)
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Outcomes of a one-shot sync
+const (
+	SyncStatusSynced   = "synced"
+	SyncStatusNotReady = "not-ready"
+	SyncStatusSkipped  = "skipped"
+	SyncStatusFailed   = "failed"
+)
+
+// Delay between two attempts of a one-shot sync when the reconciler did not ask for a specific one
+const syncOnceRetryDelay = 5 * time.Second
+
+// SyncResult is the outcome of the one-shot sync of a Certificate
+type SyncResult struct {
+	Certificate string `json:"certificate"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ListMatchingCertificates lists the Certificates of the cluster matching the filters
+func ListMatchingCertificates(ctx context.Context, c client.Client, filters Filters) ([]certmanagerv1.Certificate, error) {
+	var certificates certmanagerv1.CertificateList
+	if err := c.List(ctx, &certificates); err != nil {
+		return nil, err
+	}
+	var matching []certmanagerv1.Certificate
+	for _, certificate := range certificates.Items {
+		identities, err := certificateIdentities(ctx, c, &certificate)
+		if err != nil {
+			return nil, err
+		}
+		if filters.Match(certificate.Namespace, identities) {
+			matching = append(matching, certificate)
+		}
+	}
+	return matching, nil
+}
+
+// SyncOnce runs the reconciliation of a Certificate until it is synced or the timeout expires,
+// following the requeues the reconciler asks for
+func (r *CertManagerCertificateReconciler) SyncOnce(ctx context.Context, key types.NamespacedName, timeout time.Duration) SyncResult {
+	result := SyncResult{Certificate: key.String()}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		result.Attempts++
+		failures, _ := r.recordedFailures(ctx, key)
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+
+		retryAfter := res.RequeueAfter
+		switch {
+		case err != nil:
+			result.Status, result.Error = SyncStatusFailed, err.Error()
+		case retryAfter > 0 || res.Requeue:
+			// The reconciler records the failures, it otherwise waits for a rotation to complete
+			if newFailures, lastError := r.recordedFailures(ctx, key); newFailures > failures {
+				result.Status, result.Error = SyncStatusFailed, lastError
+			} else {
+				result.Status, result.Error = SyncStatusNotReady, "Certificate rotation in progress"
+			}
+		default:
+			var certificate certmanagerv1.Certificate
+			if err := r.Get(ctx, key, &certificate); err != nil {
+				if client.IgnoreNotFound(err) == nil {
+					// Deleted: the reconciler cleaned up AWS ACM
+					result.Status, result.Error = SyncStatusSynced, ""
+					return result
+				}
+				result.Status, result.Error = SyncStatusFailed, err.Error()
+			} else if !isCertificateIssued(&certificate) {
+				result.Status, result.Error = SyncStatusNotReady, "Certificate is not issued yet"
+			} else if identities, err := certificateIdentities(ctx, r.Client, &certificate); err != nil {
+				result.Status, result.Error = SyncStatusFailed, err.Error()
+			} else if !FiltersFromEnv().Match(certificate.Namespace, identities) {
+				// The reconciler left it alone, or released it
+				result.Status, result.Error = SyncStatusSkipped, "Certificate does not match the filters"
+				return result
+			} else if !r.AWSACMService.DryRun && !isRevisionImported(&certificate) {
+				// Nothing to import, for instance a Secret without certificate data
+				result.Status, result.Error = SyncStatusFailed, "Certificate was not imported into AWS ACM, see the logs"
+			} else {
+				result.Status, result.Error = SyncStatusSynced, ""
+				return result
+			}
+		}
+
+		if retryAfter <= 0 {
+			retryAfter = syncOnceRetryDelay
+		}
+		if time.Now().Add(retryAfter).After(deadline) {
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// Read the consecutive sync failures and the last error recorded on a Certificate, none if it cannot be read
+func (r *CertManagerCertificateReconciler) recordedFailures(ctx context.Context, key types.NamespacedName) (int, string) {
+	var certificate certmanagerv1.Certificate
+	if err := r.Get(ctx, key, &certificate); err != nil {
+		return 0, ""
+	}
+	failures, _ := strconv.Atoi(certificate.GetAnnotations()[failureCountAnnotation])
+	return failures, certificate.GetAnnotations()[lastErrorAnnotation]
+}
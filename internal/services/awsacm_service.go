@@ -1,13 +1,15 @@
 package aws_acm
 
 import (
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"strings"
+	"net"
+	"time"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/acm"
 	"github.com/go-logr/logr"
@@ -16,36 +18,50 @@ import (
 type AWSACMService struct {
 	client *acm.ACM
 	Log    logr.Logger
+	// DryRun makes the service perform reads only: mutations are logged and counted instead
+	DryRun bool
+	// DropRootCertificates removes the self-signed roots from the imported certificate chains
+	DropRootCertificates bool
+	// DeletionGracePeriod delays the deletion of the certificates no longer synced, which are only marked
+	// pending deletion, 0 to delete them right away
+	DeletionGracePeriod time.Duration
+	// OnCircuitBreakerOpen is called once when the calls to AWS ACM are paused
+	OnCircuitBreakerOpen func(err error)
+	breaker              *circuitBreaker
 }
 
-func NewAWSACMService(region string) (*AWSACMService, error) {
+func NewAWSACMService(region string, limits APILimits) (*AWSACMService, error) {
 	// Initialize AWS session with the region from environment variable
-	sess, err := session.NewSession(&aws.Config{
+	sess, err := session.NewSession(request.WithRetryer(&aws.Config{
 		Region: aws.String(region),
-	})
+	}, limits.retryer()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create AWS session: %w", err)
 	}
 
 	client := acm.New(sess)
 
-	return &AWSACMService{
+	svc := &AWSACMService{
 		client: client,
 		Log:    ctrl.Log.WithName("AWSACMService"),
-	}, nil
+	}
+	svc.installCircuitBreaker()
+	svc.installRateLimiter(rateLimiterFor(region, limits))
+	return svc, nil
 }
 
+// Tag identifying, on an imported ACM certificate, the Kubernetes object it was synced from
+const OwnerTagKey = "acm-cmcertificate-sync/owner"
+
 // FindCertificateForDomain checks if a certificate exists for a given domain in ACM
 func (svc *AWSACMService) FindCertificateForDomain(domain string) (*acm.CertificateSummary, error) {
-	input := &acm.ListCertificatesInput{}
-	result, err := svc.client.ListCertificates(input)
+	summaries, err := svc.listCertificateSummaries()
 	if err != nil {
-		svc.Log.Error(err, "failed to list certificates in ACM")
 		return nil, err
 	}
 
 	// Loop through the certificates and find one that matches the domain
-	for _, certSummary := range result.CertificateSummaryList {
+	for _, certSummary := range summaries {
 		if aws.StringValue(certSummary.DomainName) == domain {
 			return certSummary, nil
 		}
@@ -53,24 +69,161 @@ func (svc *AWSACMService) FindCertificateForDomain(domain string) (*acm.Certific
 	return nil, nil
 }
 
-// Function to import or update a certificate in ACM
-func (svc *AWSACMService) ImportOrUpdateCertificate(domain string, certData string, privateKey string) error {
-	// Check if the certificate already exists in ACM
-	certSummary, err := svc.FindCertificateForDomain(domain)
+// List every certificate in ACM, whatever its key algorithm (ACM only lists RSA_2048 and RSA_1024 keys by default)
+func (svc *AWSACMService) listCertificateSummaries() ([]*acm.CertificateSummary, error) {
+	input := &acm.ListCertificatesInput{
+		Includes: &acm.Filters{KeyTypes: aws.StringSlice(acm.KeyAlgorithm_Values())},
+	}
+	var summaries []*acm.CertificateSummary
+	err := svc.client.ListCertificatesPages(input, func(page *acm.ListCertificatesOutput, lastPage bool) bool {
+		summaries = append(summaries, page.CertificateSummaryList...)
+		return true
+	})
+	return summaries, wrapError("ListCertificates", "", err)
+}
+
+// Function to get the tags of an ACM certificate
+func (svc *AWSACMService) getCertificateTags(certificateArn string) (map[string]string, error) {
+	result, err := svc.client.ListTagsForCertificate(&acm.ListTagsForCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
+	if err != nil {
+		return nil, wrapError("ListTagsForCertificate", certificateArn, err)
+	}
+	tags := map[string]string{}
+	for _, tag := range result.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	return tags, nil
+}
+
+// Function to get the owner tag of an ACM certificate, empty if the certificate has no owner
+func (svc *AWSACMService) GetCertificateOwner(certificateArn string) (string, error) {
+	tags, err := svc.getCertificateTags(certificateArn)
+	if err != nil {
+		return "", err
+	}
+	return tags[OwnerTagKey], nil
+}
+
+// Function to set the owner tag of an ACM certificate, when it is not already set to this owner.
+// A certificate pending deletion is taken back: its pending deletion tag is removed.
+func (svc *AWSACMService) SetCertificateOwner(certificateArn string, owner string) error {
+	tags, err := svc.getCertificateTags(certificateArn)
 	if err != nil {
-		svc.Log.Error(err, "failed to find certificate in ACM")
 		return err
 	}
+	if _, pending := tags[PendingDeletionTagKey]; pending {
+		if err := svc.ClearPendingDeletion(certificateArn); err != nil {
+			return err
+		}
+	}
+	currentOwner := tags[OwnerTagKey]
+	if currentOwner == owner {
+		return nil
+	}
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationTag, "certificateArn", certificateArn, "owner", owner, "previousOwner", currentOwner)
+		return nil
+	}
+	_, err = svc.client.AddTagsToCertificate(&acm.AddTagsToCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+		Tags:           []*acm.Tag{{Key: aws.String(OwnerTagKey), Value: aws.String(owner)}},
+	})
+	if err != nil {
+		return wrapError("AddTagsToCertificate", certificateArn, err)
+	}
+	svc.Log.Info("Tagged ACM certificate owner", "certificateArn", certificateArn, "owner", owner, "previousOwner", currentOwner)
+	return nil
+}
+
+// Function to remove the owner tag of an ACM certificate, which is then left alone by the garbage collection
+func (svc *AWSACMService) RemoveCertificateOwner(certificateArn string) error {
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationUntag, "certificateArn", certificateArn)
+		return nil
+	}
+	_, err := svc.client.RemoveTagsFromCertificate(&acm.RemoveTagsFromCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+		Tags:           []*acm.Tag{{Key: aws.String(OwnerTagKey)}},
+	})
+	if err != nil {
+		return wrapError("RemoveTagsFromCertificate", certificateArn, err)
+	}
+	svc.Log.Info("Removed ACM certificate owner tag", "certificateArn", certificateArn)
+	return nil
+}
+
+// Find the ACM certificate to update for a domain: the one previously imported for it, by its ARN, otherwise the one
+// whose domain name is the domain, nil if there is none. IP addresses are never the domain name of an ACM certificate.
+func (svc *AWSACMService) findCertificateToUpdate(domain string, certificateArn string) (*acm.CertificateSummary, error) {
+	if certificateArn == "" {
+		if net.ParseIP(domain) != nil {
+			return nil, nil
+		}
+		return svc.FindCertificateForDomain(domain)
+	}
+	result, err := svc.client.DescribeCertificate(&acm.DescribeCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
+	if err := wrapError("DescribeCertificate", certificateArn, err); err != nil {
+		// Deleted in the meantime: a new certificate is imported
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	detail := result.Certificate
+	return &acm.CertificateSummary{
+		CertificateArn: detail.CertificateArn,
+		DomainName:     detail.DomainName,
+		NotBefore:      detail.NotBefore,
+		NotAfter:       detail.NotAfter,
+	}, nil
+}
+
+// Function to import or update a certificate in ACM, tagged with its owner, returns the ARN of the ACM certificate.
+// The ACM certificate previously imported for the domain, certificateArn, is updated; without one, the ACM certificate
+// found for the domain is adopted, if any. The certificate chain is built according to the chain options. Certificates
+// outside of their validity period, or older than the ACM certificate they would overwrite, are refused unless forced.
+func (svc *AWSACMService) ImportOrUpdateCertificate(domain string, certificateArn string, owner string, certData string,
+	privateKey string, chain ChainOptions, force bool) (string, error) {
+	// Check if the certificate already exists in ACM
+	certSummary, err := svc.findCertificateToUpdate(domain, certificateArn)
+	if err != nil {
+		return "", err
+	}
 
 	// Split the certificate into leaf certificate and certificate chain
-	leafCert, certChain, err := splitCertificateAndChain(certData)
+	leafCert, certChain, err := buildChain(certData, privateKey, chain, svc.DropRootCertificates)
 	if err != nil {
-		svc.Log.Error(err, "failed to split certificate and chain")
-		return err
+		return "", err
+	}
+
+	// Check the certificate before ACM rejects it with an opaque error
+	leaf, err := validateKeyPair(leafCert, privateKey)
+	if err != nil {
+		return "", err
+	}
+	if !force {
+		if err := checkValidityPeriod(leaf, time.Now()); err != nil {
+			return "", err
+		}
+		// Refuse to overwrite a newer certificate, for instance with a Secret restored from a backup
+		if certSummary != nil {
+			if err := checkNotDowngrade(leaf, certSummary); err != nil {
+				return "", err
+			}
+		}
 	}
 
 	// If the certificate exists, update it
 	if certSummary != nil {
+		// Take ownership of the certificate, it is adopted if it was imported by someone else
+		if err := svc.SetCertificateOwner(aws.StringValue(certSummary.CertificateArn), owner); err != nil {
+			return "", err
+		}
+
 		// Import the new certificate
 		importInput := &acm.ImportCertificateInput{
 			CertificateArn:   certSummary.CertificateArn,
@@ -78,86 +231,50 @@ func (svc *AWSACMService) ImportOrUpdateCertificate(domain string, certData stri
 			CertificateChain: []byte(certChain),
 			PrivateKey:       []byte(privateKey),
 		}
-		_, err := svc.client.ImportCertificate(importInput)
-		if err != nil {
-			svc.Log.Error(err, "failed to update ACM certificate")
-			return err
-		}
-		fmt.Printf("Updated ACM certificate `%s` for domain: %s", *certSummary.CertificateArn, domain)
-	} else {
-		// If no certificate exists, import a new one
-		importInput := &acm.ImportCertificateInput{
-			Certificate:      []byte(leafCert),
-			CertificateChain: []byte(certChain),
-			PrivateKey:       []byte(privateKey),
+		if svc.DryRun {
+			svc.recordDryRun(dryRunOperationUpdate, "certificateArn", aws.StringValue(certSummary.CertificateArn), "domain", domain)
+			return aws.StringValue(certSummary.CertificateArn), nil
 		}
 		_, err := svc.client.ImportCertificate(importInput)
 		if err != nil {
-			svc.Log.Error(err, "failed to import ACM certificate")
-			return err
+			return "", wrapError("ImportCertificate", aws.StringValue(certSummary.CertificateArn), err)
 		}
-		svc.Log.Info("Imported new ACM certificate for domain", "domain", domain)
+		svc.Log.Info("Updated ACM certificate for domain", "domain", domain, "certificateArn", aws.StringValue(certSummary.CertificateArn))
+		return aws.StringValue(certSummary.CertificateArn), nil
 	}
 
-	return nil
-}
-
-// Helper function to split the leaf certificate and the certificate chain
-func splitCertificateAndChain(certData string) (string, string, error) {
-	var leafCert string
-	var certChain string
-
-	// Iterate over the certData and split based on PEM blocks
-	var pemBlocks []string
-	for {
-		block, rest := pem.Decode([]byte(certData))
-		if block == nil {
-			break
-		}
-		pemBlocks = append(pemBlocks, string(pem.EncodeToMemory(block)))
-		certData = string(rest)
+	// If no certificate exists, import a new one
+	importInput := &acm.ImportCertificateInput{
+		Certificate:      []byte(leafCert),
+		CertificateChain: []byte(certChain),
+		PrivateKey:       []byte(privateKey),
+		Tags:             []*acm.Tag{{Key: aws.String(OwnerTagKey), Value: aws.String(owner)}},
 	}
-
-	if len(pemBlocks) < 1 {
-		return "", "", fmt.Errorf("no valid PEM blocks found")
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationImport, "domain", domain)
+		return "", nil
 	}
-
-	// The first certificate is usually the leaf certificate
-	leafCert = pemBlocks[0]
-
-	// The rest form the certificate chain (intermediate certificates)
-	if len(pemBlocks) > 1 {
-		certChain = strings.Join(pemBlocks[1:], "")
+	result, err := svc.client.ImportCertificate(importInput)
+	if err != nil {
+		return "", wrapError("ImportCertificate", "", err)
 	}
+	svc.Log.Info("Imported new ACM certificate for domain", "domain", domain, "certificateArn", aws.StringValue(result.CertificateArn))
 
-	return leafCert, certChain, nil
+	return aws.StringValue(result.CertificateArn), nil
 }
 
-// Function to delete a certificate from ACM by its domain
-func (svc *AWSACMService) DeleteCertificateByCommonName(domain string) error {
-	// Check if the certificate exists in ACM
-	certSummary, err := svc.FindCertificateForDomain(domain)
-	if err != nil {
-		svc.Log.Error(err, "failed to find certificate in ACM")
-		return err
-	}
-
-	if certSummary == nil {
-		svc.Log.Info("Certificate not found in ACM")
+// Function to delete a certificate from ACM by its ARN
+func (svc *AWSACMService) DeleteCertificate(certificateArn string) error {
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationDelete, "certificateArn", certificateArn)
 		return nil
 	}
-
-	// Delete the certificate
-	deleteInput := &acm.DeleteCertificateInput{
-		CertificateArn: certSummary.CertificateArn,
-	}
-	_, err = svc.client.DeleteCertificate(deleteInput)
+	_, err := svc.client.DeleteCertificate(&acm.DeleteCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
 	if err != nil {
-		svc.Log.Error(err, "failed to delete ACM certificate")
-		return err
+		return wrapError("DeleteCertificate", certificateArn, err)
 	}
-
-	svc.Log.Info("Deleted ACM certificate", "certificateArn", *certSummary.CertificateArn, "domain", domain)
-
+	svc.Log.Info("Deleted ACM certificate", "certificateArn", certificateArn)
 	return nil
 }
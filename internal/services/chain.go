@@ -0,0 +1,221 @@
+package aws_acm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+)
+
+// ChainOptions controls how the certificate chain imported into ACM is built
+type ChainOptions struct {
+	// PEM encoded certificates the chain is completed from when issuers are missing from the certificate data
+	CABundle string
+	// Common name of the issuer the chain should end at, among the alternate chains of cross-signed roots
+	PreferredIssuer string
+}
+
+// Limits of the alternate chains explored for a leaf certificate
+const (
+	maxChainLength     = 8
+	maxAlternateChains = 16
+)
+
+// Build the leaf certificate and the certificate chain to import into ACM from the PEM blocks of certData:
+// the leaf is the certificate matching the private key, and the chain is made of the issuers of the leaf,
+// deduplicated and ordered from the leaf issuer up. Issuers missing from certData are looked up in the CA bundle.
+// When cross-signed certificates offer alternate chains, the chain ending at the preferred issuer is selected,
+// truncated after the certificate it issued, otherwise the chain following the certificates of certData.
+// Self-signed roots are dropped if requested. Certificates of certData which are not part of a chain of the leaf
+// are reported as a broken chain, the unused certificates of the CA bundle are ignored.
+func buildChain(certData string, privateKey string, opts ChainOptions, dropRoots bool) (string, string, error) {
+	certificates, err := parseCertificateBlocks(certData)
+	if err != nil {
+		return "", "", err
+	}
+	// The certificates of certData come first, then the ones only in the CA bundle
+	ownCertificates := len(certificates)
+	if strings.TrimSpace(opts.CABundle) != "" {
+		bundle, err := parseCertificateBlocks(opts.CABundle)
+		if err != nil {
+			return "", "", err
+		}
+		certificates = appendMissingCertificates(certificates, bundle)
+	}
+	key, err := parsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	leaf, err := findLeaf(certificates, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	chains := alternateChains(leaf, certificates)
+	used := map[*x509.Certificate]bool{leaf: true}
+	for _, chain := range chains {
+		for _, certificate := range chain {
+			used[certificate] = true
+		}
+	}
+	for _, certificate := range certificates[:ownCertificates] {
+		if !used[certificate] {
+			return "", "", validationErrorf("broken certificate chain: %q is not an issuer of %q",
+				certificate.Subject.String(), leaf.Subject.String())
+		}
+	}
+
+	chain := chains[0]
+	if opts.PreferredIssuer != "" {
+		chain = preferredChain(leaf, chains, opts.PreferredIssuer, chain)
+	}
+
+	var chainPEM strings.Builder
+	for _, certificate := range chain {
+		if dropRoots && isSelfSigned(certificate) {
+			continue
+		}
+		chainPEM.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})), chainPEM.String(), nil
+}
+
+// LeafCertificate returns the leaf certificate of the PEM blocks of certData: the one matching the private key,
+// wherever it is in the bundle
+func LeafCertificate(certData string, privateKey string) (*x509.Certificate, error) {
+	certificates, err := parseCertificateBlocks(certData)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return findLeaf(certificates, key)
+}
+
+// Find the certificate of the private key
+func findLeaf(certificates []*x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	for _, certificate := range certificates {
+		if publicKey, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && publicKey.Equal(key.Public()) {
+			return certificate, nil
+		}
+	}
+	return nil, validationErrorf("no certificate matches the private key")
+}
+
+// Enumerate the chains of issuers of the leaf, the first one following the order of the certificates
+func alternateChains(leaf *x509.Certificate, certificates []*x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	var follow func(path []*x509.Certificate)
+	follow = func(path []*x509.Certificate) {
+		if len(chains) >= maxAlternateChains {
+			return
+		}
+		current := leaf
+		if len(path) > 0 {
+			current = path[len(path)-1]
+		}
+		var issuers []*x509.Certificate
+		if !isSelfSigned(current) && len(path) < maxChainLength {
+			issuers = findIssuers(current, certificates, append([]*x509.Certificate{leaf}, path...))
+		}
+		if len(issuers) == 0 {
+			chains = append(chains, append([]*x509.Certificate(nil), path...))
+			return
+		}
+		for _, issuer := range issuers {
+			follow(append(path, issuer))
+		}
+	}
+	follow(nil)
+	return chains
+}
+
+// Select the longest chain, or the longest beginning of a chain, whose last certificate was issued by the
+// preferred issuer, the default chain if none was
+func preferredChain(leaf *x509.Certificate, chains [][]*x509.Certificate, preferredIssuer string,
+	defaultChain []*x509.Certificate) []*x509.Certificate {
+	var preferred []*x509.Certificate
+	found := leaf.Issuer.CommonName == preferredIssuer
+	for _, chain := range chains {
+		for length := len(chain); length > len(preferred); length-- {
+			if chain[length-1].Issuer.CommonName == preferredIssuer {
+				preferred, found = chain[:length], true
+				break
+			}
+		}
+	}
+	if !found {
+		return defaultChain
+	}
+	return preferred
+}
+
+// Append the certificates which are not already in the list
+func appendMissingCertificates(certificates []*x509.Certificate, others []*x509.Certificate) []*x509.Certificate {
+	for _, other := range others {
+		if !containsCertificate(certificates, other) {
+			certificates = append(certificates, other)
+		}
+	}
+	return certificates
+}
+
+// Check if a list contains a certificate
+func containsCertificate(certificates []*x509.Certificate, certificate *x509.Certificate) bool {
+	for _, other := range certificates {
+		if bytes.Equal(other.Raw, certificate.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the PEM blocks of certData, which must all be certificates, dropping the duplicates
+func parseCertificateBlocks(certData string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(certData)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, validationErrorf("unexpected %s PEM block in the certificate data", block.Type)
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, validationErrorf("a certificate of the chain cannot be parsed: %v", err)
+		}
+		if !containsCertificate(certificates, certificate) {
+			certificates = append(certificates, certificate)
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, validationErrorf("no PEM encoded certificate found")
+	}
+	return certificates, nil
+}
+
+// Find the issuers of a certificate, excluding the certificates of the path already followed
+func findIssuers(certificate *x509.Certificate, certificates []*x509.Certificate, path []*x509.Certificate) []*x509.Certificate {
+	var issuers []*x509.Certificate
+	for _, candidate := range certificates {
+		if containsCertificate(path, candidate) || !bytes.Equal(candidate.RawSubject, certificate.RawIssuer) {
+			continue
+		}
+		if certificate.CheckSignatureFrom(candidate) == nil {
+			issuers = append(issuers, candidate)
+		}
+	}
+	return issuers
+}
+
+// Check if a certificate is a self-signed root
+func isSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawSubject, certificate.RawIssuer) && certificate.CheckSignatureFrom(certificate) == nil
+}
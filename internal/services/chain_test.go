@@ -0,0 +1,222 @@
+package aws_acm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	pem         string
+}
+
+// Issue a test certificate, self-signed when issuer is nil
+func issueCertificate(t *testing.T, commonName string, isCA bool, issuer *testCertificate) *testCertificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.certificate, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		pem:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// Cross-sign a CA certificate: issue a certificate with its subject and key from another issuer
+func crossSign(t *testing.T, ca *testCertificate, issuer *testCertificate) *testCertificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               ca.certificate.Subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer.certificate, ca.key.Public(), issuer.key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{
+		certificate: certificate,
+		key:         ca.key,
+		pem:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+func (c *testCertificate) keyPEM(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func TestBuildChain(t *testing.T) {
+	root := issueCertificate(t, "Root CA", true, nil)
+	intermediate := issueCertificate(t, "Intermediate CA", true, root)
+	leaf := issueCertificate(t, "www.example.com", false, intermediate)
+	otherRoot := issueCertificate(t, "Other Root CA", true, nil)
+
+	t.Run("ordered chain", func(t *testing.T) {
+		leafPEM, chainPEM, err := buildChain(leaf.pem+intermediate.pem+root.pem, leaf.keyPEM(t), ChainOptions{}, false)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Equal(t, intermediate.pem+root.pem, chainPEM)
+	})
+
+	t.Run("unordered chain with duplicates", func(t *testing.T) {
+		certData := root.pem + intermediate.pem + leaf.pem + intermediate.pem
+		leafPEM, chainPEM, err := buildChain(certData, leaf.keyPEM(t), ChainOptions{}, false)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Equal(t, intermediate.pem+root.pem, chainPEM)
+	})
+
+	t.Run("roots dropped", func(t *testing.T) {
+		leafPEM, chainPEM, err := buildChain(leaf.pem+intermediate.pem+root.pem, leaf.keyPEM(t), ChainOptions{}, true)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Equal(t, intermediate.pem, chainPEM)
+	})
+
+	t.Run("leaf only", func(t *testing.T) {
+		leafPEM, chainPEM, err := buildChain(leaf.pem, leaf.keyPEM(t), ChainOptions{}, false)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Empty(t, chainPEM)
+	})
+
+	t.Run("chain completed from the CA bundle", func(t *testing.T) {
+		caBundle := otherRoot.pem + root.pem + intermediate.pem
+		leafPEM, chainPEM, err := buildChain(leaf.pem, leaf.keyPEM(t), ChainOptions{CABundle: caBundle}, false)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Equal(t, intermediate.pem+root.pem, chainPEM)
+	})
+
+	t.Run("chain completed from the CA bundle, preferring tls.crt", func(t *testing.T) {
+		leafPEM, chainPEM, err := buildChain(leaf.pem+intermediate.pem, leaf.keyPEM(t), ChainOptions{CABundle: root.pem + intermediate.pem}, true)
+		require.NoError(t, err)
+		assert.Equal(t, leaf.pem, leafPEM)
+		assert.Equal(t, intermediate.pem, chainPEM)
+	})
+
+	invalid := []struct {
+		name     string
+		certData string
+		keyData  string
+		reason   string
+	}{
+		{"broken chain", leaf.pem + intermediate.pem + otherRoot.pem, leaf.keyPEM(t),
+			`broken certificate chain: "CN=Other Root CA" is not an issuer of "CN=www.example.com"`},
+		{"missing link", leaf.pem + root.pem, leaf.keyPEM(t),
+			`broken certificate chain: "CN=Root CA" is not an issuer of "CN=www.example.com"`},
+		{"no certificate matching the key", intermediate.pem + root.pem, leaf.keyPEM(t),
+			"no certificate matches the private key"},
+		{"private key in the certificate data", leaf.pem + leaf.keyPEM(t), leaf.keyPEM(t),
+			"unexpected EC PRIVATE KEY PEM block in the certificate data"},
+		{"no certificate", "", leaf.keyPEM(t), "no PEM encoded certificate found"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := buildChain(tc.certData, tc.keyData, ChainOptions{}, false)
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected a ValidationError, got %v", err)
+			assert.Equal(t, tc.reason, validationErr.Reason)
+		})
+	}
+}
+
+func TestBuildChainPreferredIssuer(t *testing.T) {
+	legacyRoot := issueCertificate(t, "Legacy Root CA", true, nil)
+	root := issueCertificate(t, "Root CA", true, nil)
+	crossSignedRoot := crossSign(t, root, legacyRoot)
+	intermediate := issueCertificate(t, "Intermediate CA", true, root)
+	leaf := issueCertificate(t, "www.example.com", false, intermediate)
+	// Default chain ending at the legacy root, as served for the compatibility with older clients
+	certData := leaf.pem + intermediate.pem + crossSignedRoot.pem
+
+	tests := []struct {
+		name            string
+		certData        string
+		caBundle        string
+		preferredIssuer string
+		chain           string
+	}{
+		{"no preference", certData, "", "", intermediate.pem + crossSignedRoot.pem},
+		{"default chain preferred", certData, "", "Legacy Root CA", intermediate.pem + crossSignedRoot.pem},
+		{"chain truncated at the preferred issuer", certData, "", "Root CA", intermediate.pem},
+		{"alternate chain from the CA bundle", certData, root.pem, "Root CA", intermediate.pem + root.pem},
+		{"alternate chain from tls.crt", certData + root.pem, "", "Root CA", intermediate.pem + root.pem},
+		{"unknown preferred issuer", certData, root.pem, "Unknown CA", intermediate.pem + crossSignedRoot.pem},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ChainOptions{CABundle: tc.caBundle, PreferredIssuer: tc.preferredIssuer}
+			leafPEM, chainPEM, err := buildChain(tc.certData, leaf.keyPEM(t), opts, false)
+			require.NoError(t, err)
+			assert.Equal(t, leaf.pem, leafPEM)
+			assert.Equal(t, tc.chain, chainPEM)
+		})
+	}
+}
+
+func TestLeafCertificate(t *testing.T) {
+	root := issueCertificate(t, "Root CA", true, nil)
+	intermediate := issueCertificate(t, "Intermediate CA", true, root)
+	leaf := issueCertificate(t, "www.example.com", false, intermediate)
+
+	t.Run("leaf first", func(t *testing.T) {
+		certificate, err := LeafCertificate(leaf.pem+intermediate.pem, leaf.keyPEM(t))
+		require.NoError(t, err)
+		assert.Equal(t, leaf.certificate.Raw, certificate.Raw)
+	})
+
+	t.Run("intermediate first", func(t *testing.T) {
+		certificate, err := LeafCertificate(intermediate.pem+leaf.pem+root.pem, leaf.keyPEM(t))
+		require.NoError(t, err)
+		assert.Equal(t, leaf.certificate.Raw, certificate.Raw)
+
+		fingerprint, err := Fingerprint(intermediate.pem+leaf.pem, leaf.keyPEM(t))
+		require.NoError(t, err)
+		leafFingerprint, err := Fingerprint(leaf.pem, leaf.keyPEM(t))
+		require.NoError(t, err)
+		assert.Equal(t, leafFingerprint, fingerprint)
+	})
+
+	t.Run("no certificate matching the key", func(t *testing.T) {
+		_, err := LeafCertificate(intermediate.pem+root.pem, leaf.keyPEM(t))
+		assert.True(t, errors.Is(err, ErrValidation))
+	})
+}
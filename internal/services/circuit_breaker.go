@@ -0,0 +1,153 @@
+package aws_acm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// Consecutive AWS ACM unavailability errors opening the circuit breaker, an access denied error opens it at once
+const circuitBreakerThreshold = 5
+
+// Delay before probing AWS ACM once the circuit breaker is open
+const circuitBreakerCooldown = time.Minute
+
+type circuitState int
+
+const (
+	// AWS ACM is called
+	circuitClosed circuitState = iota
+	// AWS ACM is not called
+	circuitOpen
+	// A single probe request is in flight, deciding whether to close the circuit
+	circuitHalfOpen
+)
+
+// circuitBreaker stops calling AWS ACM, for every certificate at once, while it is unavailable or access is denied
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	lastErr  error
+}
+
+// Check if a request can be sent to AWS ACM. Once the cooldown expired the first request is let through as a probe.
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.openedAt) < circuitBreakerCooldown {
+			return fmt.Errorf("%w: %v", ErrCircuitOpen, cb.lastErr)
+		}
+		cb.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return fmt.Errorf("%w: %v", ErrCircuitOpen, cb.lastErr)
+	}
+	return nil
+}
+
+// Record the outcome of a request sent to AWS ACM, return whether the circuit was opened or closed by it
+func (cb *circuitBreaker) record(err error) (opened bool, closed bool) {
+	class := classifyError(err)
+	tripping := class == ErrAccessDenied || class == ErrUnavailable
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch {
+	case cb.state == circuitOpen:
+		// Request sent before the circuit was opened
+	case !tripping:
+		closed = cb.state == circuitHalfOpen
+		cb.state, cb.failures, cb.lastErr = circuitClosed, 0, nil
+	case cb.state == circuitHalfOpen:
+		// Failed probe, wait for another cooldown
+		cb.state, cb.openedAt, cb.lastErr = circuitOpen, time.Now(), err
+	default:
+		cb.failures++
+		if class == ErrAccessDenied || cb.failures >= circuitBreakerThreshold {
+			opened = true
+			cb.state, cb.openedAt, cb.lastErr = circuitOpen, time.Now(), err
+		}
+	}
+	return opened, closed
+}
+
+// Return the error which opened the circuit, nil if it is closed
+func (cb *circuitBreaker) openError() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == circuitClosed {
+		return nil
+	}
+	return cb.lastErr
+}
+
+// Guard every request of the AWS ACM client with the circuit breaker
+func (svc *AWSACMService) installCircuitBreaker() {
+	svc.breaker = &circuitBreaker{}
+	svc.client.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "acmcmcertificatesync.CircuitBreakerAllow",
+		Fn: func(r *request.Request) {
+			if err := svc.breaker.allow(); err != nil {
+				r.Error = err
+			}
+		},
+	})
+	svc.client.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "acmcmcertificatesync.CircuitBreakerRecord",
+		Fn: func(r *request.Request) {
+			if errors.Is(r.Error, ErrCircuitOpen) {
+				return
+			}
+			opened, closed := svc.breaker.record(r.Error)
+			switch {
+			case opened:
+				circuitBreakerOpen.Set(1)
+				svc.Log.Info("AWS ACM circuit breaker opened, pausing the calls to AWS ACM", "error", r.Error.Error())
+				if svc.OnCircuitBreakerOpen != nil {
+					svc.OnCircuitBreakerOpen(r.Error)
+				}
+			case closed:
+				circuitBreakerOpen.Set(0)
+				svc.Log.Info("AWS ACM circuit breaker closed, resuming the calls to AWS ACM")
+			}
+		},
+	})
+}
+
+// CheckCircuitBreaker is a readiness check failing while the AWS ACM circuit breaker is open
+func (svc *AWSACMService) CheckCircuitBreaker(_ *http.Request) error {
+	if err := svc.breaker.openError(); err != nil {
+		return fmt.Errorf("%w: %v", ErrCircuitOpen, err)
+	}
+	return nil
+}
+
+// ProbeCircuitBreaker periodically probes AWS ACM with a read while the circuit breaker is open,
+// so that it closes without waiting for a certificate to be retried
+func (svc *AWSACMService) ProbeCircuitBreaker(ctx context.Context) error {
+	ticker := time.NewTicker(circuitBreakerCooldown / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if svc.breaker.openError() == nil {
+				continue
+			}
+			// Rejected without calling AWS ACM until the cooldown expires
+			_, _ = svc.client.ListCertificatesWithContext(ctx, &acm.ListCertificatesInput{MaxItems: aws.Int64(1)})
+		}
+	}
+}
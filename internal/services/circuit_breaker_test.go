@@ -0,0 +1,145 @@
+package aws_acm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	unavailableErr  = awserr.New("ServiceUnavailable", "service unavailable", nil)
+	accessDeniedErr = awserr.New(acm.ErrCodeAccessDeniedException, "access denied", nil)
+	throttledErr    = awserr.New(acm.ErrCodeThrottlingException, "rate exceeded", nil)
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class error
+	}{
+		{"no error", nil, nil},
+		{"not an AWS error", errors.New("boom"), nil},
+		{"circuit open", fmt.Errorf("%w: %v", ErrCircuitOpen, unavailableErr), ErrCircuitOpen},
+		{"throttling", throttledErr, ErrThrottled},
+		{"throttling code unknown to ACM", awserr.New("RequestLimitExceeded", "slow down", nil), ErrThrottled},
+		{"validation", awserr.New(acm.ErrCodeValidationException, "invalid", nil), ErrValidation},
+		{"invalid ARN", awserr.New(acm.ErrCodeInvalidArnException, "invalid", nil), ErrValidation},
+		{"not found", awserr.New(acm.ErrCodeResourceNotFoundException, "missing", nil), ErrNotFound},
+		{"in use", awserr.New(acm.ErrCodeResourceInUseException, "in use", nil), ErrInUse},
+		{"limit exceeded", awserr.New(acm.ErrCodeLimitExceededException, "limit", nil), ErrLimitExceeded},
+		{"access denied", accessDeniedErr, ErrAccessDenied},
+		{"expired credentials", awserr.New("ExpiredTokenException", "expired", nil), ErrAccessDenied},
+		{"unavailable", unavailableErr, ErrUnavailable},
+		{"network error", awserr.New(request.ErrCodeRequestError, "connection refused", nil), ErrUnavailable},
+		{"server error", awserr.NewRequestFailure(awserr.New("Unknown", "oops", nil), http.StatusBadGateway, "id"),
+			ErrUnavailable},
+		{"client error", awserr.NewRequestFailure(awserr.New("Unknown", "oops", nil), http.StatusBadRequest, "id"), nil},
+		{"wrapped", fmt.Errorf("import failed: %w", throttledErr), ErrThrottled},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.class, classifyError(tc.err))
+		})
+	}
+}
+
+func TestCircuitBreakerRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    circuitState
+		failures int
+		err      error
+		opened   bool
+		closed   bool
+		want     circuitState
+		failed   int
+	}{
+		{"success keeps the circuit closed", circuitClosed, 2, nil, false, false, circuitClosed, 0},
+		{"unavailability is counted", circuitClosed, 0, unavailableErr, false, false, circuitClosed, 1},
+		{"unavailability opens the circuit at the threshold", circuitClosed, circuitBreakerThreshold - 1, unavailableErr,
+			true, false, circuitOpen, circuitBreakerThreshold},
+		{"access denied opens the circuit at once", circuitClosed, 0, accessDeniedErr, true, false, circuitOpen, 1},
+		{"other errors reset the failures", circuitClosed, 3, throttledErr, false, false, circuitClosed, 0},
+		{"successful probe closes the circuit", circuitHalfOpen, 0, nil, false, true, circuitClosed, 0},
+		{"failed probe opens the circuit again", circuitHalfOpen, 0, unavailableErr, false, false, circuitOpen, 0},
+		{"requests sent before the circuit opened are ignored", circuitOpen, circuitBreakerThreshold, nil,
+			false, false, circuitOpen, circuitBreakerThreshold},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cb := &circuitBreaker{state: tc.state, failures: tc.failures}
+			opened, closed := cb.record(tc.err)
+			assert.Equal(t, tc.opened, opened, "opened")
+			assert.Equal(t, tc.closed, closed, "closed")
+			assert.Equal(t, tc.want, cb.state, "state")
+			assert.Equal(t, tc.failed, cb.failures, "failures")
+		})
+	}
+}
+
+func TestCircuitBreakerAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    circuitState
+		openedAt time.Time
+		allowed  bool
+		want     circuitState
+	}{
+		{"closed circuit", circuitClosed, time.Time{}, true, circuitClosed},
+		{"open circuit during the cooldown", circuitOpen, time.Now(), false, circuitOpen},
+		{"open circuit after the cooldown lets a probe through", circuitOpen,
+			time.Now().Add(-circuitBreakerCooldown), true, circuitHalfOpen},
+		{"half-open circuit with a probe in flight", circuitHalfOpen, time.Now().Add(-circuitBreakerCooldown),
+			false, circuitHalfOpen},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cb := &circuitBreaker{state: tc.state, openedAt: tc.openedAt, lastErr: unavailableErr}
+			err := cb.allow()
+			if tc.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, errors.Is(err, ErrCircuitOpen), "expected ErrCircuitOpen, got %v", err)
+			}
+			assert.Equal(t, tc.want, cb.state)
+		})
+	}
+}
+
+func TestCircuitBreakerCycle(t *testing.T) {
+	cb := &circuitBreaker{}
+	for i := 1; i < circuitBreakerThreshold; i++ {
+		opened, _ := cb.record(unavailableErr)
+		require.False(t, opened, "opened after %d failures", i)
+	}
+	opened, _ := cb.record(unavailableErr)
+	require.True(t, opened)
+	assert.Equal(t, unavailableErr, cb.openError())
+	assert.Error(t, cb.allow())
+
+	// The cooldown expires: a single probe goes through, and fails
+	cb.openedAt = time.Now().Add(-circuitBreakerCooldown)
+	require.NoError(t, cb.allow())
+	assert.Error(t, cb.allow(), "a second request while probing")
+	opened, closed := cb.record(unavailableErr)
+	assert.False(t, opened)
+	assert.False(t, closed)
+	assert.Error(t, cb.allow(), "a new cooldown started")
+
+	// The next probe succeeds
+	cb.openedAt = time.Now().Add(-circuitBreakerCooldown)
+	require.NoError(t, cb.allow())
+	_, closed = cb.record(nil)
+	assert.True(t, closed)
+	assert.NoError(t, cb.openError())
+	assert.NoError(t, cb.allow())
+}
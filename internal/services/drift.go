@@ -0,0 +1,67 @@
+package aws_acm
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of the leaf certificate of certData, the one matching the private key
+func Fingerprint(certData string, privateKey string) (string, error) {
+	leaf, err := LeafCertificate(certData, privateKey)
+	if err != nil {
+		return "", err
+	}
+	return fingerprint(leaf), nil
+}
+
+// Compute the SHA-256 fingerprint of a certificate
+func fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// CertificateMatches checks if the ACM certificate is the leaf certificate of certData, the one matching the private key,
+// comparing the serial numbers first and then the fingerprints. A deleted ACM certificate does not match.
+func (svc *AWSACMService) CertificateMatches(certificateArn string, certData string, privateKey string) (bool, error) {
+	leaf, err := LeafCertificate(certData, privateKey)
+	if err != nil {
+		return false, err
+	}
+
+	described, err := svc.client.DescribeCertificate(&acm.DescribeCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
+	if err := wrapError("DescribeCertificate", certificateArn, err); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if NormalizeSerial(aws.StringValue(described.Certificate.Serial)) != NormalizeSerial(leaf.SerialNumber.Text(16)) {
+		return false, nil
+	}
+
+	result, err := svc.client.GetCertificate(&acm.GetCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
+	if err != nil {
+		return false, wrapError("GetCertificate", certificateArn, err)
+	}
+	acmCertificate, err := parseCertificatePEM(aws.StringValue(result.Certificate))
+	if err != nil {
+		return false, err
+	}
+	return fingerprint(acmCertificate) == fingerprint(leaf), nil
+}
+
+// NormalizeSerial normalizes a hexadecimal serial number, as formatted by ACM ("0a:1b:...") or by big.Int, for comparison
+func NormalizeSerial(serial string) string {
+	serial = strings.ToLower(strings.ReplaceAll(serial, ":", ""))
+	return strings.TrimLeft(serial, "0")
+}
@@ -0,0 +1,106 @@
+package aws_acm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// Classes of the errors returned by the service, to be checked with errors.Is
+var (
+	ErrThrottled     = errors.New("throttled by AWS ACM")
+	ErrValidation    = errors.New("rejected by AWS ACM validation")
+	ErrNotFound      = errors.New("not found in AWS ACM")
+	ErrInUse         = errors.New("in use by AWS resources")
+	ErrLimitExceeded = errors.New("AWS ACM limit exceeded")
+	ErrAccessDenied  = errors.New("access denied to AWS ACM")
+	ErrUnavailable   = errors.New("AWS ACM unavailable")
+	// ErrCircuitOpen is returned without calling AWS ACM while the circuit breaker is open
+	ErrCircuitOpen = errors.New("AWS ACM circuit breaker open")
+)
+
+// Classes of the AWS ACM error codes
+var errorClasses = map[string]error{
+	acm.ErrCodeThrottlingException:                     ErrThrottled,
+	acm.ErrCodeValidationException:                     ErrValidation,
+	acm.ErrCodeInvalidArgsException:                    ErrValidation,
+	acm.ErrCodeInvalidArnException:                     ErrValidation,
+	acm.ErrCodeInvalidDomainValidationOptionsException: ErrValidation,
+	acm.ErrCodeInvalidParameterException:               ErrValidation,
+	acm.ErrCodeInvalidTagException:                     ErrValidation,
+	acm.ErrCodeTagPolicyException:                      ErrValidation,
+	acm.ErrCodeResourceNotFoundException:               ErrNotFound,
+	acm.ErrCodeResourceInUseException:                  ErrInUse,
+	acm.ErrCodeLimitExceededException:                  ErrLimitExceeded,
+	acm.ErrCodeTooManyTagsException:                    ErrLimitExceeded,
+	acm.ErrCodeAccessDeniedException:                   ErrAccessDenied,
+	"UnrecognizedClientException":                      ErrAccessDenied,
+	"InvalidClientTokenId":                             ErrAccessDenied,
+	"ExpiredTokenException":                            ErrAccessDenied,
+	"InternalFailure":                                  ErrUnavailable,
+	"ServiceUnavailable":                               ErrUnavailable,
+	"ServiceUnavailableException":                      ErrUnavailable,
+	request.ErrCodeRequestError:                        ErrUnavailable,
+	request.ErrCodeResponseTimeout:                     ErrUnavailable,
+	request.ErrCodeRead:                                ErrUnavailable,
+}
+
+// Error is an error of an AWS ACM operation. It matches, with errors.Is, the class of the error if it is known,
+// and unwraps to the AWS SDK error.
+type Error struct {
+	// Operation of the AWS ACM API which failed
+	Operation string
+	// ARN of the certificate the operation was performed on, if any
+	CertificateArn string
+	// Class of the error, nil if it is unknown
+	Class error
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.CertificateArn != "" {
+		return fmt.Sprintf("AWS ACM %s of %s failed: %v", e.Operation, e.CertificateArn, e.Err)
+	}
+	return fmt.Sprintf("AWS ACM %s failed: %v", e.Operation, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Class != nil && e.Class == target
+}
+
+// Wrap an error of the AWS SDK into an Error carrying its class
+func wrapError(operation string, certificateArn string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Operation: operation, CertificateArn: certificateArn, Class: classifyError(err), Err: err}
+}
+
+// Find the class of an error of the AWS SDK, nil if it is unknown
+func classifyError(err error) error {
+	if errors.Is(err, ErrCircuitOpen) {
+		return ErrCircuitOpen
+	}
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return nil
+	}
+	if class, found := errorClasses[aerr.Code()]; found {
+		return class
+	}
+	if request.IsErrorThrottle(aerr) {
+		return ErrThrottled
+	}
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) && failure.StatusCode() >= 500 {
+		return ErrUnavailable
+	}
+	return nil
+}
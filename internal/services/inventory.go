@@ -0,0 +1,74 @@
+package aws_acm
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// InventoryItem describes a certificate imported in ACM
+type InventoryItem struct {
+	ARN        string     `json:"arn"`
+	DomainName string     `json:"domainName"`
+	Owner      string     `json:"owner,omitempty"`
+	Serial     string     `json:"serial,omitempty"`
+	NotBefore  *time.Time `json:"notBefore,omitempty"`
+	NotAfter   *time.Time `json:"notAfter,omitempty"`
+	InUseBy    []string   `json:"inUseBy,omitempty"`
+	// Time the certificate was marked pending deletion at, nil if it is not
+	PendingDeletionSince *time.Time `json:"pendingDeletionSince,omitempty"`
+}
+
+// ListInventory lists the certificates imported in ACM, with their details, owner and pending deletion tags
+func (svc *AWSACMService) ListInventory() ([]InventoryItem, error) {
+	summaries, err := svc.listCertificateSummaries()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []InventoryItem
+	for _, summary := range summaries {
+		// Certificates issued by ACM cannot have been synced from the cluster
+		if aws.StringValue(summary.Type) != acm.CertificateTypeImported {
+			continue
+		}
+		item, err := svc.DescribeCertificate(aws.StringValue(summary.CertificateArn))
+		if err != nil {
+			// Deleted since it was listed
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// DescribeCertificate returns the details, owner and pending deletion tags of a certificate in ACM
+func (svc *AWSACMService) DescribeCertificate(certificateArn string) (*InventoryItem, error) {
+	result, err := svc.client.DescribeCertificate(&acm.DescribeCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+	})
+	if err != nil {
+		return nil, wrapError("DescribeCertificate", certificateArn, err)
+	}
+	tags, err := svc.getCertificateTags(certificateArn)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := result.Certificate
+	return &InventoryItem{
+		ARN:                  certificateArn,
+		DomainName:           aws.StringValue(detail.DomainName),
+		Owner:                tags[OwnerTagKey],
+		Serial:               aws.StringValue(detail.Serial),
+		NotBefore:            detail.NotBefore,
+		NotAfter:             detail.NotAfter,
+		InUseBy:              aws.StringValueSlice(detail.InUseBy),
+		PendingDeletionSince: pendingDeletionSince(tags),
+	}, nil
+}
@@ -0,0 +1,103 @@
+package aws_acm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fake AWS ACM answering each operation with the status and JSON body returned by the handler
+func newFakeACMService(t *testing.T, handler func(operation, certificateArn string) (int, interface{})) *AWSACMService {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "CertificateManager.")
+		var input struct{ CertificateArn string }
+		_ = json.NewDecoder(r.Body).Decode(&input)
+		status, output := handler(operation, input.CertificateArn)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(output)
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-3"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	return &AWSACMService{client: acm.New(sess), Log: logr.Discard()}
+}
+
+// Prefix of the ARNs of the fake certificates
+const testARN = "arn:aws:acm:eu-west-3:123456789012:certificate/"
+
+// Body of an AWS ACM error
+func fakeACMError(code string) interface{} {
+	return map[string]string{"__type": code, "message": code}
+}
+
+func TestListInventory(t *testing.T) {
+	summaries := []map[string]string{
+		{"CertificateArn": testARN + "imported", "DomainName": "www.example.com", "Type": acm.CertificateTypeImported},
+		{"CertificateArn": testARN + "issued", "DomainName": "api.example.com", "Type": acm.CertificateTypeAmazonIssued},
+		{"CertificateArn": testARN + "deleted", "DomainName": "old.example.com", "Type": acm.CertificateTypeImported},
+		{"CertificateArn": testARN + "untagged", "DomainName": "new.example.com", "Type": acm.CertificateTypeImported},
+	}
+	svc := newFakeACMService(t, func(operation, certificateArn string) (int, interface{}) {
+		switch {
+		case operation == "ListCertificates":
+			return http.StatusOK, map[string]interface{}{"CertificateSummaryList": summaries}
+		case certificateArn == testARN+"deleted" && operation == "DescribeCertificate":
+			// Deleted between the listing and the description
+			return http.StatusBadRequest, fakeACMError(acm.ErrCodeResourceNotFoundException)
+		case certificateArn == testARN+"untagged" && operation == "ListTagsForCertificate":
+			// Deleted between the description and the listing of its tags
+			return http.StatusBadRequest, fakeACMError(acm.ErrCodeResourceNotFoundException)
+		case operation == "DescribeCertificate":
+			return http.StatusOK, map[string]interface{}{"Certificate": map[string]interface{}{
+				"CertificateArn": certificateArn, "DomainName": "www.example.com", "Serial": "01",
+			}}
+		case operation == "ListTagsForCertificate":
+			return http.StatusOK, map[string]interface{}{"Tags": []map[string]string{
+				{"Key": OwnerTagKey, "Value": "Certificate/default/www"},
+				{"Key": PendingDeletionTagKey, "Value": "2026-01-02T03:04:05Z"},
+			}}
+		}
+		return http.StatusBadRequest, fakeACMError(acm.ErrCodeValidationException)
+	})
+
+	inventory, err := svc.ListInventory()
+	require.NoError(t, err)
+	require.Len(t, inventory, 1)
+	assert.Equal(t, testARN+"imported", inventory[0].ARN)
+	assert.Equal(t, "Certificate/default/www", inventory[0].Owner)
+	require.NotNil(t, inventory[0].PendingDeletionSince)
+	assert.Equal(t, "2026-01-02T03:04:05Z", inventory[0].PendingDeletionSince.UTC().Format(time.RFC3339))
+}
+
+func TestListInventoryError(t *testing.T) {
+	svc := newFakeACMService(t, func(operation, certificateArn string) (int, interface{}) {
+		if operation == "ListCertificates" {
+			return http.StatusOK, map[string]interface{}{"CertificateSummaryList": []map[string]string{
+				{"CertificateArn": testARN + "imported", "Type": acm.CertificateTypeImported},
+			}}
+		}
+		return http.StatusBadRequest, fakeACMError(acm.ErrCodeAccessDeniedException)
+	})
+
+	_, err := svc.ListInventory()
+	assert.True(t, errors.Is(err, ErrAccessDenied), "expected ErrAccessDenied, got %v", err)
+}
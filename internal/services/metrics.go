@@ -0,0 +1,64 @@
+package aws_acm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Operations skipped by the service in dry-run mode
+const (
+	dryRunOperationImport = "import"
+	dryRunOperationUpdate = "update"
+	dryRunOperationDelete = "delete"
+	dryRunOperationTag    = "tag"
+	dryRunOperationUntag  = "untag"
+)
+
+var (
+	dryRunOperationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "acm_cmcertificate_sync_dry_run_operations_total",
+			Help: "Number of AWS ACM mutations skipped because of the dry-run mode, by operation",
+		},
+		[]string{"operation"},
+	)
+	apiRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "acm_cmcertificate_sync_aws_api_requests_total",
+			Help: "Number of requests to the AWS ACM API, by operation and error code (OK on success)",
+		},
+		[]string{"operation", "code"},
+	)
+	apiRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "acm_cmcertificate_sync_aws_api_retries_total",
+			Help: "Number of retries of requests to the AWS ACM API, by operation and whether the request was throttled",
+		},
+		[]string{"operation", "throttled"},
+	)
+	rateLimitWaitSeconds = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "acm_cmcertificate_sync_aws_api_rate_limit_wait_seconds",
+			Help:    "Time the requests to the AWS ACM API waited for the client-side rate limiter",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+	)
+	circuitBreakerOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "acm_cmcertificate_sync_circuit_breaker_open",
+			Help: "Whether the calls to AWS ACM are paused by the circuit breaker (1) or not (0)",
+		},
+	)
+)
+
+func init() {
+	// Register the metrics with the controller-runtime registry, served by the manager metrics endpoint
+	metrics.Registry.MustRegister(dryRunOperationsTotal, apiRequestsTotal, apiRetriesTotal, rateLimitWaitSeconds,
+		circuitBreakerOpen)
+}
+
+// Log and count a mutation skipped because of the dry-run mode
+func (svc *AWSACMService) recordDryRun(operation string, keysAndValues ...interface{}) {
+	dryRunOperationsTotal.WithLabelValues(operation).Inc()
+	svc.Log.Info("Dry run: skipped AWS ACM mutation", append([]interface{}{"operation", operation}, keysAndValues...)...)
+}
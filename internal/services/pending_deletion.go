@@ -0,0 +1,69 @@
+package aws_acm
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// Tag marking an ACM certificate no longer synced, set to the time it was marked at (RFC 3339). The certificate is
+// deleted once the deletion grace period elapsed, unless an object takes it back in the meantime.
+const PendingDeletionTagKey = "acm-cmcertificate-sync/pending-deletion"
+
+// Function to mark an ACM certificate pending deletion, keeping the time it was first marked at
+func (svc *AWSACMService) MarkPendingDeletion(certificateArn string) error {
+	tags, err := svc.getCertificateTags(certificateArn)
+	if err != nil {
+		return err
+	}
+	if _, pending := tags[PendingDeletionTagKey]; pending {
+		return nil
+	}
+	since := time.Now().UTC().Format(time.RFC3339)
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationTag, "certificateArn", certificateArn, "pendingDeletion", since)
+		return nil
+	}
+	_, err = svc.client.AddTagsToCertificate(&acm.AddTagsToCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+		Tags:           []*acm.Tag{{Key: aws.String(PendingDeletionTagKey), Value: aws.String(since)}},
+	})
+	if err != nil {
+		return wrapError("AddTagsToCertificate", certificateArn, err)
+	}
+	svc.Log.Info("Marked ACM certificate pending deletion", "certificateArn", certificateArn,
+		"deletionGracePeriod", svc.DeletionGracePeriod)
+	return nil
+}
+
+// Function to remove the pending deletion tag of an ACM certificate
+func (svc *AWSACMService) ClearPendingDeletion(certificateArn string) error {
+	if svc.DryRun {
+		svc.recordDryRun(dryRunOperationUntag, "certificateArn", certificateArn, "tag", PendingDeletionTagKey)
+		return nil
+	}
+	_, err := svc.client.RemoveTagsFromCertificate(&acm.RemoveTagsFromCertificateInput{
+		CertificateArn: aws.String(certificateArn),
+		Tags:           []*acm.Tag{{Key: aws.String(PendingDeletionTagKey)}},
+	})
+	if err != nil {
+		return wrapError("RemoveTagsFromCertificate", certificateArn, err)
+	}
+	svc.Log.Info("Removed ACM certificate pending deletion tag", "certificateArn", certificateArn)
+	return nil
+}
+
+// Parse the time a certificate was marked pending deletion at, nil if it is not
+func pendingDeletionSince(tags map[string]string) *time.Time {
+	value, pending := tags[PendingDeletionTagKey]
+	if !pending {
+		return nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// An unreadable mark is considered as just set, delaying the deletion by a full grace period
+		since = time.Now()
+	}
+	return &since
+}
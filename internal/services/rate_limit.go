@@ -0,0 +1,108 @@
+package aws_acm
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"golang.org/x/time/rate"
+)
+
+// APILimits bounds the calls made to the AWS ACM API, whose per account and region quotas are low
+type APILimits struct {
+	// Sustained rate of the requests, per second
+	QPS float64
+	// Requests allowed at once above the sustained rate
+	Burst int
+	// Retries of a throttled or failed request, after a jittered exponential delay
+	MaxRetries int
+}
+
+// DefaultAPILimits stays below the ImportCertificate and ListCertificates quotas of AWS ACM
+var DefaultAPILimits = APILimits{QPS: 2, Burst: 5, MaxRetries: 5}
+
+// BindFlags binds the limits to command line flags, defaulting to their current values
+func (l *APILimits) BindFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&l.QPS, "acm-qps", l.QPS, "The sustained rate of the requests to AWS ACM, per second.")
+	fs.IntVar(&l.Burst, "acm-burst", l.Burst, "The number of requests to AWS ACM allowed at once above the sustained rate.")
+	fs.IntVar(&l.MaxRetries, "acm-max-retries", l.MaxRetries,
+		"The number of retries of a throttled or failed request to AWS ACM.")
+}
+
+// Retryer of the AWS ACM requests: the AWS SDK retryer delays the retries exponentially with jitter,
+// longer for the throttling errors
+func (l APILimits) retryer() request.Retryer {
+	return client.DefaultRetryer{
+		NumMaxRetries:    l.MaxRetries,
+		MinRetryDelay:    100 * time.Millisecond,
+		MaxRetryDelay:    5 * time.Second,
+		MinThrottleDelay: time.Second,
+		MaxThrottleDelay: 30 * time.Second,
+	}
+}
+
+// Rate limiters of the AWS ACM requests, shared by the services of a region as the controller uses a single account
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*rate.Limiter{}
+)
+
+// Get the rate limiter of a region, created with the given limits
+func rateLimiterFor(region string, limits APILimits) *rate.Limiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	limiter, found := rateLimiters[region]
+	if !found {
+		limiter = rate.NewLimiter(rate.Limit(limits.QPS), limits.Burst)
+		rateLimiters[region] = limiter
+	}
+	return limiter
+}
+
+// Rate limit every attempt of the requests of the AWS ACM client, and measure the requests and their retries
+func (svc *AWSACMService) installRateLimiter(limiter *rate.Limiter) {
+	svc.client.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+		Name: "acmcmcertificatesync.RateLimiter",
+		Fn: func(r *request.Request) {
+			start := time.Now()
+			if err := limiter.Wait(r.Context()); err != nil {
+				r.Error = awserr.New(request.CanceledErrorCode, "request rate limiting canceled", err)
+				return
+			}
+			rateLimitWaitSeconds.Observe(time.Since(start).Seconds())
+		},
+	})
+	svc.client.Handlers.AfterRetry.PushFrontNamed(request.NamedHandler{
+		Name: "acmcmcertificatesync.RetryMetrics",
+		Fn: func(r *request.Request) {
+			// Decided here as the AWS SDK retry handler would, which keeps the decision
+			if r.Retryable == nil {
+				r.Retryable = aws.Bool(r.ShouldRetry(r))
+			}
+			if r.WillRetry() {
+				throttled := "false"
+				if request.IsErrorThrottle(r.Error) {
+					throttled = "true"
+				}
+				apiRetriesTotal.WithLabelValues(r.Operation.Name, throttled).Inc()
+			}
+		},
+	})
+	svc.client.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "acmcmcertificatesync.RequestMetrics",
+		Fn: func(r *request.Request) {
+			code := "OK"
+			if aerr, ok := r.Error.(awserr.Error); ok {
+				code = aerr.Code()
+			} else if r.Error != nil {
+				// Rejected by the circuit breaker without calling AWS ACM
+				return
+			}
+			apiRequestsTotal.WithLabelValues(r.Operation.Name, code).Inc()
+		},
+	})
+}
@@ -0,0 +1,116 @@
+package aws_acm
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	certmanagerv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ReadCertificateData reads the PEM encoded certificate and private key from the data of a Secret, at the given keys.
+// When they are missing there, they are read from the additional outputs of cert-manager, in this order: the
+// CombinedPEM format, the DER format (the private key only), and the PKCS#12 keystore, decrypted with the password
+// returned by pkcs12Password (nil when the keystore has no password configured, which skips it).
+// Returns nil data when the Secret carries no usable certificate or key.
+func ReadCertificateData(data map[string][]byte, certKey, keyKey string,
+	pkcs12Password func() (string, error)) ([]byte, []byte, error) {
+	certData := data[certKey]
+	keyData := data[keyKey]
+
+	// Combined PEM output: the private key followed by the certificate chain
+	if combined, found := data[certmanagerv1.CertificateOutputFormatCombinedPEMKey]; found && (len(certData) == 0 || len(keyData) == 0) {
+		combinedCert, combinedKey := splitCombinedPEM(combined)
+		if len(certData) == 0 {
+			certData = combinedCert
+		}
+		if len(keyData) == 0 {
+			keyData = combinedKey
+		}
+	}
+
+	// DER output: the private key only
+	if der, found := data[certmanagerv1.CertificateOutputFormatDERKey]; found && len(keyData) == 0 {
+		key, err := privateKeyDERToPEM(der)
+		if err != nil {
+			return nil, nil, validationErrorf("failed to decode %s: %v", certmanagerv1.CertificateOutputFormatDERKey, err)
+		}
+		keyData = key
+	}
+
+	// PKCS#12 keystore output
+	if keystore, found := data[certmanagerv1.PKCS12SecretKey]; found && (len(certData) == 0 || len(keyData) == 0) &&
+		pkcs12Password != nil {
+		password, err := pkcs12Password()
+		if err != nil {
+			return nil, nil, err
+		}
+		keystoreCert, keystoreKey, err := decodePKCS12(keystore, password)
+		if err != nil {
+			return nil, nil, validationErrorf("failed to decode %s: %v", certmanagerv1.PKCS12SecretKey, err)
+		}
+		if len(certData) == 0 {
+			certData = keystoreCert
+		}
+		if len(keyData) == 0 {
+			keyData = keystoreKey
+		}
+	}
+
+	if len(certData) == 0 || len(keyData) == 0 {
+		return nil, nil, nil
+	}
+	return certData, keyData, nil
+}
+
+// Split a combined PEM into its certificates and its private key
+func splitCombinedPEM(combined []byte) ([]byte, []byte) {
+	var certData, keyData bytes.Buffer
+	for rest := combined; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certData.Write(pem.EncodeToMemory(block))
+		} else if keyData.Len() == 0 {
+			keyData.Write(pem.EncodeToMemory(block))
+		}
+	}
+	return certData.Bytes(), keyData.Bytes()
+}
+
+// Encode a PKCS#8, PKCS#1 or SEC 1 DER private key in PEM
+func privateKeyDERToPEM(der []byte) ([]byte, error) {
+	if _, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}), nil
+	}
+	if _, err := x509.ParseECPrivateKey(der); err == nil {
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	}
+	return nil, fmt.Errorf("unsupported private key format")
+}
+
+// Decode a PKCS#12 keystore into its PEM encoded certificate chain and private key
+func decodePKCS12(keystore []byte, password string) ([]byte, []byte, error) {
+	key, certificate, caCertificates, err := pkcs12.DecodeChain(keystore, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var certData bytes.Buffer
+	certData.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+	for _, caCertificate := range caCertificates {
+		certData.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCertificate.Raw}))
+	}
+	return certData.Bytes(), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
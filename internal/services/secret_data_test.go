@@ -0,0 +1,193 @@
+package aws_acm
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestSplitCombinedPEM(t *testing.T) {
+	root := issueCertificate(t, "Root CA", true, nil)
+	leaf := issueCertificate(t, "www.example.com", false, root)
+	otherKey := issueCertificate(t, "other", false, nil).keyPEM(t)
+
+	tests := []struct {
+		name     string
+		combined string
+		certData string
+		keyData  string
+	}{
+		{"key then chain", leaf.keyPEM(t) + leaf.pem + root.pem, leaf.pem + root.pem, leaf.keyPEM(t)},
+		{"chain then key", leaf.pem + root.pem + leaf.keyPEM(t), leaf.pem + root.pem, leaf.keyPEM(t)},
+		{"first key only", leaf.keyPEM(t) + leaf.pem + otherKey, leaf.pem, leaf.keyPEM(t)},
+		{"certificates only", leaf.pem, leaf.pem, ""},
+		{"empty", "", "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			certData, keyData := splitCombinedPEM([]byte(tc.combined))
+			assert.Equal(t, tc.certData, string(certData))
+			assert.Equal(t, tc.keyData, string(keyData))
+		})
+	}
+}
+
+func TestPrivateKeyDERToPEM(t *testing.T) {
+	ecKey := issueCertificate(t, "www.example.com", false, nil).key
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	sec1DER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		der       []byte
+		blockType string
+	}{
+		{"PKCS#8", pkcs8DER, "PRIVATE KEY"},
+		{"PKCS#1", x509.MarshalPKCS1PrivateKey(rsaKey), "RSA PRIVATE KEY"},
+		{"SEC 1", sec1DER, "EC PRIVATE KEY"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keyData, err := privateKeyDERToPEM(tc.der)
+			require.NoError(t, err)
+			block, _ := pem.Decode(keyData)
+			require.NotNil(t, block)
+			assert.Equal(t, tc.blockType, block.Type)
+			assert.Equal(t, tc.der, block.Bytes)
+		})
+	}
+
+	_, err = privateKeyDERToPEM([]byte("not a key"))
+	assert.EqualError(t, err, "unsupported private key format")
+}
+
+func TestDecodePKCS12(t *testing.T) {
+	root := issueCertificate(t, "Root CA", true, nil)
+	leaf := issueCertificate(t, "www.example.com", false, root)
+	keystore, err := pkcs12.Modern.Encode(leaf.key, leaf.certificate, []*x509.Certificate{root.certificate}, "secret")
+	require.NoError(t, err)
+
+	certData, keyData, err := decodePKCS12(keystore, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, leaf.pem+root.pem, string(certData))
+	certificate, err := LeafCertificate(string(certData), string(keyData))
+	require.NoError(t, err)
+	assert.Equal(t, leaf.certificate.Raw, certificate.Raw)
+
+	_, _, err = decodePKCS12(keystore, "wrong")
+	assert.Error(t, err)
+}
+
+func TestReadCertificateData(t *testing.T) {
+	root := issueCertificate(t, "Root CA", true, nil)
+	leaf := issueCertificate(t, "www.example.com", false, root)
+	other := issueCertificate(t, "other.example.com", false, root)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.key)
+	require.NoError(t, err)
+	keyDERPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	keystore, err := pkcs12.Modern.Encode(leaf.key, leaf.certificate, nil, "secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     map[string][]byte
+		certKey  string
+		keyKey   string
+		certData string
+		keyData  string
+		password bool
+	}{
+		{"configured keys first", map[string][]byte{
+			"tls.crt":            []byte(leaf.pem),
+			"tls.key":            []byte(leaf.keyPEM(t)),
+			"tls-combined.pem":   []byte(other.keyPEM(t) + other.pem),
+			"keystore.p12":       keystore,
+			"custom-ignored.crt": []byte(other.pem),
+		}, "tls.crt", "tls.key", leaf.pem, leaf.keyPEM(t), false},
+		{"custom keys", map[string][]byte{
+			"tls.crt":  []byte(other.pem),
+			"tls.key":  []byte(other.keyPEM(t)),
+			"cert.pem": []byte(leaf.pem),
+			"key.pem":  []byte(leaf.keyPEM(t)),
+		}, "cert.pem", "key.pem", leaf.pem, leaf.keyPEM(t), false},
+		{"missing key read from the combined PEM", map[string][]byte{
+			"tls.crt":          []byte(leaf.pem + root.pem),
+			"tls-combined.pem": []byte(leaf.keyPEM(t) + leaf.pem),
+		}, "tls.crt", "tls.key", leaf.pem + root.pem, leaf.keyPEM(t), false},
+		{"combined PEM before DER", map[string][]byte{
+			"tls-combined.pem": []byte(leaf.keyPEM(t) + leaf.pem),
+			"key.der":          []byte("not a key"),
+		}, "tls.crt", "tls.key", leaf.pem, leaf.keyPEM(t), false},
+		{"missing key read from DER", map[string][]byte{
+			"tls.crt": []byte(leaf.pem),
+			"key.der": keyDER,
+		}, "tls.crt", "tls.key", leaf.pem, keyDERPEM, false},
+		{"DER before PKCS#12", map[string][]byte{
+			"tls.crt":      []byte(leaf.pem),
+			"key.der":      keyDER,
+			"keystore.p12": []byte("not a keystore"),
+		}, "tls.crt", "tls.key", leaf.pem, keyDERPEM, false},
+		{"PKCS#12 last", map[string][]byte{
+			"keystore.p12": keystore,
+		}, "tls.crt", "tls.key", leaf.pem, keyDERPEM, true},
+		{"PKCS#12 without password", map[string][]byte{
+			"keystore.p12": keystore,
+		}, "tls.crt", "tls.key", "", "", false},
+		{"no key", map[string][]byte{
+			"tls.crt": []byte(leaf.pem),
+		}, "tls.crt", "tls.key", "", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var password func() (string, error)
+			if tc.password {
+				password = func() (string, error) { return "secret", nil }
+			}
+			certData, keyData, err := ReadCertificateData(tc.data, tc.certKey, tc.keyKey, password)
+			require.NoError(t, err)
+			assert.Equal(t, tc.certData, string(certData))
+			assert.Equal(t, tc.keyData, string(keyData))
+		})
+	}
+
+	t.Run("password only read for the keystore", func(t *testing.T) {
+		data := map[string][]byte{"tls.crt": []byte(leaf.pem), "tls.key": []byte(leaf.keyPEM(t)), "keystore.p12": keystore}
+		_, _, err := ReadCertificateData(data, "tls.crt", "tls.key", func() (string, error) {
+			t.Error("password read while the keystore is not needed")
+			return "", nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("password error", func(t *testing.T) {
+		passwordErr := errors.New("no password Secret")
+		_, _, err := ReadCertificateData(map[string][]byte{"keystore.p12": keystore}, "tls.crt", "tls.key",
+			func() (string, error) { return "", passwordErr })
+		assert.Equal(t, passwordErr, err)
+	})
+
+	t.Run("invalid DER", func(t *testing.T) {
+		_, _, err := ReadCertificateData(map[string][]byte{"tls.crt": []byte(leaf.pem), "key.der": []byte("not a key")},
+			"tls.crt", "tls.key", nil)
+		assert.True(t, errors.Is(err, ErrValidation), "expected ErrValidation, got %v", err)
+		assert.ErrorContains(t, err, "failed to decode key.der: unsupported private key format")
+	})
+
+	t.Run("invalid keystore", func(t *testing.T) {
+		_, _, err := ReadCertificateData(map[string][]byte{"keystore.p12": keystore}, "tls.crt", "tls.key",
+			func() (string, error) { return "wrong", nil })
+		assert.True(t, errors.Is(err, ErrValidation), "expected ErrValidation, got %v", err)
+		assert.ErrorContains(t, err, "failed to decode keystore.p12")
+	})
+}
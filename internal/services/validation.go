@@ -0,0 +1,160 @@
+package aws_acm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+)
+
+// Causes of the refusal to overwrite an ACM certificate, which can be forced. Matched by ValidationError with errors.Is.
+var (
+	ErrInvalidPeriod = errors.New("certificate outside of its validity period")
+	ErrDowngrade     = errors.New("certificate older than the ACM certificate")
+)
+
+// ValidationError explains why a certificate cannot be imported into ACM. It matches ErrValidation with errors.Is,
+// and its cause if any.
+type ValidationError struct {
+	Reason string
+	// Cause of the error when the import can be forced, ErrInvalidPeriod or ErrDowngrade
+	Cause error
+}
+
+func (e *ValidationError) Error() string {
+	return "certificate cannot be imported into AWS ACM: " + e.Reason
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation || (e.Cause != nil && target == e.Cause)
+}
+
+func validationErrorf(format string, args ...interface{}) error {
+	return &ValidationError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Sizes of the RSA keys and curves of the EC keys ACM can import
+var (
+	supportedRSAKeySizes = map[int]bool{1024: true, 2048: true, 3072: true, 4096: true}
+	supportedCurves      = map[elliptic.Curve]bool{elliptic.P256(): true, elliptic.P384(): true, elliptic.P521(): true}
+)
+
+// Check that ACM supports the key of the certificate, and that it matches the certificate
+func validateKeyPair(certData string, privateKey string) (*x509.Certificate, error) {
+	leaf, err := parseCertificatePEM(certData)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePrivateKeyPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkKeyAlgorithm(key.Public()); err != nil {
+		return nil, err
+	}
+	publicKey, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(key.Public()) {
+		return nil, validationErrorf("the private key does not match the certificate")
+	}
+	return leaf, nil
+}
+
+// Check that the certificate is valid at the given time
+func checkValidityPeriod(leaf *x509.Certificate, now time.Time) error {
+	if now.Before(leaf.NotBefore) {
+		return &ValidationError{Cause: ErrInvalidPeriod,
+			Reason: fmt.Sprintf("the certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))}
+	}
+	if now.After(leaf.NotAfter) {
+		return &ValidationError{Cause: ErrInvalidPeriod,
+			Reason: fmt.Sprintf("the certificate expired on %s", leaf.NotAfter.UTC().Format(time.RFC3339))}
+	}
+	return nil
+}
+
+// Check that the certificate was not issued before the ACM certificate it would overwrite
+func checkNotDowngrade(leaf *x509.Certificate, current *acm.CertificateSummary) error {
+	if current.NotBefore == nil || !leaf.NotBefore.Before(*current.NotBefore) {
+		return nil
+	}
+	return &ValidationError{Cause: ErrDowngrade, Reason: fmt.Sprintf(
+		"the certificate (valid from %s to %s) is older than AWS ACM certificate %s (valid from %s to %s)",
+		leaf.NotBefore.UTC().Format(time.RFC3339), leaf.NotAfter.UTC().Format(time.RFC3339),
+		aws.StringValue(current.CertificateArn), current.NotBefore.UTC().Format(time.RFC3339),
+		aws.TimeValue(current.NotAfter).UTC().Format(time.RFC3339))}
+}
+
+// Parse the first PEM block of certData as a certificate
+func parseCertificatePEM(certData string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certData))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, validationErrorf("no PEM encoded certificate found")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, validationErrorf("the certificate cannot be parsed: %v", err)
+	}
+	return leaf, nil
+}
+
+// Parse an unencrypted PEM encoded private key, in PKCS#1, SEC 1 or PKCS#8 format
+func parsePrivateKeyPEM(privateKey string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, validationErrorf("no PEM encoded private key found")
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, validationErrorf("the private key is encrypted, ACM only imports unencrypted keys")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, validationErrorf("unsupported private key PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, validationErrorf("the private key cannot be parsed: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, validationErrorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// Check that ACM supports the algorithm and size of a key
+func checkKeyAlgorithm(publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if !supportedRSAKeySizes[key.N.BitLen()] {
+			return validationErrorf("RSA keys of %d bits are not supported, use 1024, 2048, 3072 or 4096 bits", key.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		if !supportedCurves[key.Curve] {
+			return validationErrorf("the %s curve is not supported, use P-256, P-384 or P-521", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return validationErrorf("Ed25519 keys are not supported, use RSA or ECDSA keys")
+	default:
+		return validationErrorf("%T keys are not supported, use RSA or ECDSA keys", publicKey)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package aws_acm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/acm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Generate a self-signed PEM encoded certificate for a key, and the PKCS#8 PEM encoded key
+func generateCertificate(t *testing.T, key crypto.Signer, notBefore, notAfter time.Time) (string, string) {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestValidateKeyPair(t *testing.T) {
+	now := time.Now()
+	valid := func(t *testing.T, key crypto.Signer) (string, string) {
+		return generateCertificate(t, key, now.Add(-time.Hour), now.Add(time.Hour))
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1536)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("valid RSA certificate", func(t *testing.T) {
+		certData, keyData := valid(t, rsaKey)
+		leaf, err := validateKeyPair(certData, keyData)
+		require.NoError(t, err)
+		assert.Equal(t, "www.example.com", leaf.Subject.CommonName)
+	})
+
+	t.Run("valid ECDSA certificate with a SEC 1 key", func(t *testing.T) {
+		certData, _ := valid(t, ecKey)
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		require.NoError(t, err)
+		keyData := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+		_, err = validateKeyPair(certData, keyData)
+		assert.NoError(t, err)
+	})
+
+	t.Run("valid RSA certificate with a PKCS#1 key", func(t *testing.T) {
+		certData, _ := valid(t, rsaKey)
+		keyData := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+		_, err := validateKeyPair(certData, keyData)
+		assert.NoError(t, err)
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		// The validity period is checked separately, as it can be forced
+		certData, keyData := generateCertificate(t, rsaKey, now.Add(-2*time.Hour), now.Add(-time.Hour))
+		_, err := validateKeyPair(certData, keyData)
+		assert.NoError(t, err)
+	})
+
+	invalid := []struct {
+		name   string
+		input  func(t *testing.T) (string, string)
+		reason string
+	}{
+		{"Ed25519 key", func(t *testing.T) (string, string) { return valid(t, ed25519Key) },
+			"Ed25519 keys are not supported, use RSA or ECDSA keys"},
+		{"unsupported curve", func(t *testing.T) (string, string) { return valid(t, p224Key) },
+			"the P-224 curve is not supported, use P-256, P-384 or P-521"},
+		{"unsupported RSA key size", func(t *testing.T) (string, string) { return valid(t, smallRSAKey) },
+			"RSA keys of 1536 bits are not supported, use 1024, 2048, 3072 or 4096 bits"},
+		{"mismatched key", func(t *testing.T) (string, string) {
+			certData, _ := valid(t, rsaKey)
+			_, keyData := valid(t, otherRSAKey)
+			return certData, keyData
+		}, "the private key does not match the certificate"},
+		{"encrypted key", func(t *testing.T) (string, string) {
+			certData, _ := valid(t, rsaKey)
+			return certData, string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("secret")}))
+		}, "the private key is encrypted, ACM only imports unencrypted keys"},
+		{"no certificate", func(t *testing.T) (string, string) {
+			_, keyData := valid(t, rsaKey)
+			return "", keyData
+		}, "no PEM encoded certificate found"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			certData, keyData := tc.input(t)
+			_, err := validateKeyPair(certData, keyData)
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected a ValidationError, got %v", err)
+			assert.Equal(t, tc.reason, validationErr.Reason)
+			assert.True(t, errors.Is(err, ErrValidation))
+			assert.False(t, errors.Is(err, ErrInvalidPeriod))
+		})
+	}
+}
+
+func TestCheckValidityPeriod(t *testing.T) {
+	now := time.Now()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	certificate := func(notBefore, notAfter time.Time) *x509.Certificate {
+		certData, _ := generateCertificate(t, key, notBefore, notAfter)
+		leaf, err := parseCertificatePEM(certData)
+		require.NoError(t, err)
+		return leaf
+	}
+
+	assert.NoError(t, checkValidityPeriod(certificate(now.Add(-time.Hour), now.Add(time.Hour)), now))
+
+	invalid := []struct {
+		name   string
+		leaf   *x509.Certificate
+		reason string
+	}{
+		{"expired certificate", certificate(now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			"the certificate expired on " + now.Add(-time.Hour).UTC().Format(time.RFC3339)},
+		{"certificate not yet valid", certificate(now.Add(time.Hour), now.Add(2*time.Hour)),
+			"the certificate is not valid before " + now.Add(time.Hour).UTC().Format(time.RFC3339)},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkValidityPeriod(tc.leaf, now)
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected a ValidationError, got %v", err)
+			assert.Equal(t, tc.reason, validationErr.Reason)
+			assert.True(t, errors.Is(err, ErrValidation))
+			assert.True(t, errors.Is(err, ErrInvalidPeriod))
+		})
+	}
+}
+
+func TestCheckNotDowngrade(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	certData, _ := generateCertificate(t, key, now.Add(-time.Hour), now.Add(time.Hour))
+	leaf, err := parseCertificatePEM(certData)
+	require.NoError(t, err)
+
+	current := func(notBefore time.Time) *acm.CertificateSummary {
+		return &acm.CertificateSummary{
+			CertificateArn: aws.String("arn:aws:acm:eu-west-3:123456789012:certificate/current"),
+			NotBefore:      aws.Time(notBefore),
+			NotAfter:       aws.Time(notBefore.Add(2 * time.Hour)),
+		}
+	}
+
+	assert.NoError(t, checkNotDowngrade(leaf, current(now.Add(-2*time.Hour))), "certificate newer than the ACM one")
+	assert.NoError(t, checkNotDowngrade(leaf, current(now.Add(-time.Hour))), "certificate as old as the ACM one")
+	assert.NoError(t, checkNotDowngrade(leaf, &acm.CertificateSummary{}), "ACM certificate validity unknown")
+
+	err = checkNotDowngrade(leaf, current(now))
+	assert.True(t, errors.Is(err, ErrDowngrade))
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.False(t, errors.Is(err, ErrInvalidPeriod))
+}